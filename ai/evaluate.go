@@ -296,16 +296,34 @@ var WeightNohatAdjust = []float64{
 func evaluateNohat(w []float64, m *MinimaxAI, p *tak.Position, size int) int64 {
 	size2 := size * size
 	sizefactor := 1 / float64(size)
-	var path uint64
-	var roads [4][36]uint8
-	var seeker uint64 = 5<<49 + 1<<uint(50-size) + 1<<uint(50+size)
-	var spreadmask uint64 = (1 << uint(size)) - 1
-	for a := 0; a < 4; a++ {
-		for b := 0; b < size2; b++ {
-			roads[a][b] = 7
+	// roads[c][spot] is the cheapest road through spot: white's
+	// and black's bottom-to-top roads in 0 and 1, and their
+	// left-to-right roads in 2 and 3. A road costs 1 per empty
+	// square, 2 per own wall or enemy flat and 4 per enemy wall or
+	// capstone; anything over 6 counts as 7.
+	var roads [4][]uint8
+	var buf [4][64]uint8
+	empty := m.c.Mask &^ (p.White | p.Black)
+	for c, own := range [2]uint64{p.White, p.Black} {
+		opp := (p.White | p.Black) &^ own
+		costs := bitboard.Costs{
+			own &^ p.Standing,
+			empty,
+			opp&^(p.Standing|p.Caps) | own&p.Standing,
+			0,
+			opp & (p.Standing | p.Caps),
+		}
+		roads[c] = bitboard.RoadDistances(&m.c, costs, m.c.B, m.c.T, 6, buf[c][:0])
+		roads[c+2] = bitboard.RoadDistances(&m.c, costs, m.c.R, m.c.L, 6, buf[c+2][:0])
+	}
+	for a := range roads {
+		for b := range roads[a] {
+			if roads[a][b] > 7 {
+				roads[a][b] = 7
+			}
 		}
 	}
-	var directions = [4]int{1, -size, -1, size}
+	var spreadmask uint64 = (1 << uint(size)) - 1
 	var leftmask uint64 = 0
 	var rightmask uint64 = 0
 	var topmask uint64 = 0
@@ -320,155 +338,6 @@ func evaluateNohat(w []float64, m *MinimaxAI, p *tak.Position, size int) int64 {
 	var edge2mask = topmask + bottommask
 	var offedge1mask = (leftmask << 1) + (rightmask >> 1)
 	var offedge2mask = (topmask >> uint(size)) + (bottommask << uint(size))
-	var path1 func(spot int, direction int, whitein uint8, blackin uint8) (uint8, uint8)
-	path1 = func(spot int, direction int, whitein uint8, blackin uint8) (uint8, uint8) {
-		var spotmask uint64 = 1 << uint(spot)
-		var newdirection int
-		var newspot int
-		var newspotmask uint64
-		var whiteout uint8 = 7
-		var blackout uint8 = 7
-		var newwhiteout uint8
-		var newblackout uint8
-		if p.White&spotmask != 0 {
-			if p.Standing&spotmask != 0 {
-				blackin += 4
-				whitein += 2
-			} else if p.Caps&spotmask != 0 {
-				blackin += 4
-			} else {
-				blackin += 2
-			}
-		} else if p.Black&spotmask != 0 {
-			if p.Standing&spotmask != 0 {
-				whitein += 4
-				blackin += 2
-			} else if p.Caps&spotmask != 0 {
-				whitein += 4
-			} else {
-				whitein += 2
-			}
-		} else {
-			whitein++
-			blackin++
-		}
-		if whitein > 6 && blackin > 6 {
-			return 7, 7
-		} else if spotmask&topmask == 0 {
-			path ^= spotmask
-			for a := 0; a < 4; a++ {
-				newdirection = directions[a]
-				newspot = spot + newdirection
-				if direction+newdirection != 0 && (seeker>>uint(50-newspot)&path&^spotmask) == 0 {
-					newspotmask = 1 << uint(newspot)
-					if newspot >= size && ((path|newspotmask)&leftmask == 0 || (path|newspotmask)&rightmask == 0) {
-						newwhiteout, newblackout = path1(newspot, newdirection, whitein, blackin)
-						if newwhiteout < whiteout {
-							whiteout = newwhiteout
-						}
-						if newblackout < blackout {
-							blackout = newblackout
-						}
-					}
-				}
-			}
-			path ^= spotmask
-		} else {
-			whiteout = whitein
-			blackout = blackin
-		}
-		if roads[0][spot] > whiteout {
-			roads[0][spot] = whiteout
-		}
-		if roads[1][spot] > blackout {
-			roads[1][spot] = blackout
-		}
-		return whiteout, blackout
-	}
-	var path2 func(spot int, direction int, whitein uint8, blackin uint8) (uint8, uint8)
-	path2 = func(spot int, direction int, whitein uint8, blackin uint8) (uint8, uint8) {
-		var spotmask uint64 = 1 << uint(spot)
-		var newdirection int
-		var newspot int
-		var newspotmask uint64
-		var whiteout uint8 = 7
-		var blackout uint8 = 7
-		var newwhiteout uint8
-		var newblackout uint8
-		if p.White&spotmask != 0 {
-			if p.Standing&spotmask != 0 {
-				blackin += 4
-				whitein += 2
-			} else if p.Caps&spotmask != 0 {
-				blackin += 4
-			} else {
-				blackin += 2
-			}
-		} else if p.Black&spotmask != 0 {
-			if p.Standing&spotmask != 0 {
-				whitein += 4
-				blackin += 2
-			} else if p.Caps&spotmask != 0 {
-				whitein += 4
-			} else {
-				whitein += 2
-			}
-		} else {
-			whitein++
-			blackin++
-		}
-		if whitein > 6 && blackin > 6 {
-			return 7, 7
-		} else if spotmask&rightmask == 0 {
-			path ^= spotmask
-			for a := 0; a < 4; a++ {
-				newdirection = directions[a]
-				newspot = spot + newdirection
-				if newspot >= 0 && newspot < size2 {
-					newspotmask = 1 << uint(newspot)
-					if direction+newdirection != 0 && ((seeker>>uint(50-newspot)&path&^spotmask) == 0 || newspotmask&rightmask != 0) {
-						if newspotmask&leftmask == 0 && ((path|newspotmask)&topmask == 0 || (path|newspotmask)&bottommask == 0) {
-							newwhiteout, newblackout = path2(newspot, newdirection, whitein, blackin)
-							if newwhiteout < whiteout {
-								whiteout = newwhiteout
-							}
-							if newblackout < blackout {
-								blackout = newblackout
-							}
-						}
-					}
-				}
-			}
-			path ^= spotmask
-		} else {
-			whiteout = whitein
-			blackout = blackin
-			/*
-				for a := 0;a<size;a++{
-					for b := 0;b<size;b++{
-						fmt.Printf("%d", ((path|spotmask)>>uint(b+a*size))&1)
-					}
-					fmt.Printf("\n")
-				}
-				fmt.Printf("\n")
-			*/
-		}
-		if roads[2][spot] > whiteout {
-			roads[2][spot] = whiteout
-		}
-		if roads[3][spot] > blackout {
-			roads[3][spot] = blackout
-		}
-		return whiteout, blackout
-	}
-	for a := 0; a < size; a++ {
-		path = 0
-		path1(a, size, 0, 0)
-	}
-	for a := 0; a < size2; a += size {
-		path = 0
-		path2(a, 1, 0, 0)
-	}
 	/*
 		fmt.Printf("Boards:\n\n")
 		fmt.Printf("%+v\n\n", p)
@@ -498,14 +367,15 @@ func evaluateNohat(w []float64, m *MinimaxAI, p *tak.Position, size int) int64 {
 		left = p.BlackStones()
 	}
 	flatcount := float64(bitboard.Popcount(p.White&^p.Standing)-bitboard.Popcount(p.Black&^p.Standing)) * w[16]
+	flatcount -= float64(p.HalfKomi()) / 2 * w[16]
 	flatcount += float64(p.WhiteCaps()-p.BlackCaps()) * w[19] * float64(left) / float64(size2)
 	flatcount += float64(bitboard.Popcount(p.White&p.Standing)-bitboard.Popcount(p.Black&p.Standing)) * w[24] * float64(left) / float64(size2)
 	for a := 0; a < size2; a++ {
 		h := p.Height[a]
 		if h > 1 {
 			topwhite := p.White&(1<<uint(a)) != 0
-			blacks := float64(bitboard.Popcount(p.Stacks[a]))
-			whites := float64(h) - 1 - blacks
+			cw, cb := p.Captives(a)
+			whites, blacks := float64(cw), float64(cb)
 			if topwhite {
 				flatcount += whites * w[17]
 				flatcount -= blacks * w[18]
@@ -649,16 +519,8 @@ func evaluateNohat(w []float64, m *MinimaxAI, p *tak.Position, size int) int64 {
 			return MinEval + int64(p.MoveNumber())*1000000 + int64(value)
 		}
 	}
-	var searchpos *tak.Position
-	var err error
-	for _, move := range p.Threatmoves {
-		searchpos, err = p.MovePreallocated(&move, searchpos)
-		if err == nil {
-			over, winner := searchpos.GameOver()
-			if over && searchpos.ToMove() != winner {
-				return int64(value) + 8000
-			}
-		}
+	if p.HasRoadThreat(p.ToMove()) {
+		return int64(value) + 8000
 	}
 	//fmt.Printf("%+v\n\n", value)
 	return int64(value)
@@ -690,6 +552,8 @@ func evaluate(w *Weights, m *MinimaxAI, p *tak.Position) int64 {
 
 	ws += int64(bitboard.Popcount(p.White&^p.Caps&^p.Standing) * flat)
 	bs += int64(bitboard.Popcount(p.Black&^p.Caps&^p.Standing) * flat)
+	// round half a flat up, so that a komi of 0.5 still counts
+	bs += int64((p.HalfKomi()*flat + 1) / 2)
 	ws += int64(bitboard.Popcount(p.White&p.Standing) * w.Standing)
 	bs += int64(bitboard.Popcount(p.Black&p.Standing) * w.Standing)
 	ws += int64(bitboard.Popcount(p.White&p.Caps) * w.Capstone)
@@ -700,16 +564,14 @@ func evaluate(w *Weights, m *MinimaxAI, p *tak.Position) int64 {
 			continue
 		}
 		bit := uint64(1 << uint(i))
-		s := p.Stacks[i] & ((1 << (h - 1)) - 1)
+		wf, bf := p.Captives(i)
 		var hf, sf int
 		var ptr *int64
 		if p.White&bit != 0 {
-			sf = bitboard.Popcount(s)
-			hf = int(h) - sf - 1
+			hf, sf = wf, bf
 			ptr = &ws
 		} else {
-			hf = bitboard.Popcount(s)
-			sf = int(h) - hf - 1
+			hf, sf = bf, wf
 			ptr = &bs
 		}
 
@@ -777,9 +639,7 @@ func ExplainScore(m *MinimaxAI, out io.Writer, p *tak.Position) {
 		if h <= 1 {
 			continue
 		}
-		s := p.Stacks[i] & ((1 << (h - 1)) - 1)
-		bf := bitboard.Popcount(s)
-		wf := int(h) - bf - 1
+		wf, bf := p.Captives(i)
 		scores[0].stones += wf
 		scores[1].stones += bf
 
@@ -799,6 +659,9 @@ func ExplainScore(m *MinimaxAI, out io.Writer, p *tak.Position) {
 	fmt.Fprintf(tw, "caps\t%d\t%d\n", scores[0].caps, scores[1].caps)
 	fmt.Fprintf(tw, "captured\t%d\t%d\n", scores[0].captured, scores[1].captured)
 	fmt.Fprintf(tw, "stones\t%d\t%d\n", scores[0].stones, scores[1].stones)
+	if p.HalfKomi() != 0 {
+		fmt.Fprintf(tw, "komi\t\t%d.%d\n", p.HalfKomi()/2, 5*(p.HalfKomi()%2))
+	}
 
 	analysis := p.Analysis()
 
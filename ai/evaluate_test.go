@@ -0,0 +1,60 @@
+package ai
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"../tak"
+)
+
+func TestEvaluateAllSizes(t *testing.T) {
+	for _, size := range []int{3, 4, 5, 6, 7, 8} {
+		evals := map[string]EvaluationFunc{
+			"default": MakeEvaluator(size, nil),
+			"nohat":   MakeNohat(size, nil),
+		}
+		m := NewMinimax(MinimaxConfig{Size: size, Depth: 1})
+		r := NewRandom(int64(size))
+		p := tak.New(tak.Config{Size: size})
+		for ply := 0; ply < 200; ply++ {
+			for name, eval := range evals {
+				func() {
+					defer func() {
+						if e := recover(); e != nil {
+							t.Fatalf("size=%d ply=%d %s: %v", size, ply, name, e)
+						}
+					}()
+					eval(m, p)
+				}()
+			}
+			if over, _ := p.GameOver(); over {
+				break
+			}
+			mv := r.GetMove(context.Background(), p)
+			p, _ = p.Move(&mv)
+		}
+	}
+}
+
+func TestEvaluateHalfKomi(t *testing.T) {
+	w := DefaultWeights[5]
+	w.TopFlat = 401
+	w.EndgameFlat = 0
+	eval := MakeEvaluator(5, &w)
+	m := NewMinimax(MinimaxConfig{Size: 5, Depth: 1})
+	base := eval(m, tak.New(tak.Config{Size: 5}))
+	for _, tc := range []struct {
+		halfKomi int
+		delta    int64
+	}{
+		{1, 201},
+		{2, 401},
+		{5, 1003},
+	} {
+		v := eval(m, tak.New(tak.Config{Size: 5, HalfKomi: tc.halfKomi}))
+		if d := base - v; d != tc.delta {
+			t.Errorf("HalfKomi=%d: komi cost white %d want %d", tc.halfKomi, d, tc.delta)
+		}
+	}
+}
@@ -148,13 +148,10 @@ func (mc *MonteCarloAI) populate(ctx context.Context, t *tree) {
 		return
 	}
 
-	moves := t.position.AllMoves(nil)
+	moves := t.position.LegalMoves(nil)
 	t.children = make([]*tree, 0, len(moves))
 	for _, m := range moves {
-		child, e := t.position.Move(&m)
-		if e != nil {
-			continue
-		}
+		child, _ := t.position.Move(&m)
 		t.children = append(t.children, &tree{
 			position: child,
 			move:     m,
@@ -10,18 +10,8 @@ import (
 func UniformRandomPolicy(ctx context.Context,
 	m *MonteCarloAI,
 	p *tak.Position, alloc *tak.Position) *tak.Position {
-	moves := p.AllMoves(nil)
-	var next *tak.Position
-	for {
-		r := m.r.Int31n(int32(len(moves)))
-		m := moves[r]
-		var e error
-		if next, e = p.MovePreallocated(&m, alloc); e == nil {
-			break
-		}
-		moves[0], moves[r] = moves[r], moves[0]
-		moves = moves[1:]
-	}
+	moves := p.LegalMoves(nil)
+	next, _ := p.MovePreallocated(&moves[m.r.Int31n(int32(len(moves)))], alloc)
 	return next
 }
 
@@ -45,14 +35,11 @@ func EvalWeightedPolicy(ctx context.Context,
 	mc *MonteCarloAI,
 	p *tak.Position, alloc *tak.Position) *tak.Position {
 	var buf [500]tak.Move
-	moves := p.AllMoves(buf[:])
+	moves := p.LegalMoves(buf[:0])
 	var best tak.Move
 	var sum int64
 	for _, m := range moves {
-		child, e := p.MovePreallocated(&m, alloc)
-		if e != nil {
-			continue
-		}
+		child, _ := p.MovePreallocated(&m, alloc)
 		w := mc.eval(mc.mm, child)
 		if w > ai.WinThreshold {
 			return child
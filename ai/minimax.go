@@ -6,6 +6,7 @@ import (
 	"log"
 	"math"
 	"math/rand"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -22,6 +23,8 @@ const (
 	WinThreshold       = 1 << 29
 	Illegal            = -1 << 31
 
+	// tableSize is the number of entries in the transposition
+	// table unless MinimaxConfig.TableMB sets its size.
 	tableSize uint64 = (1 << 20)
 
 	maxDepth = 15
@@ -41,13 +44,20 @@ type MinimaxAI struct {
 
 	evaluate EvaluationFunc
 
-	table []tableEntry
+	table *table
+	// helpers are the extra searches run by Analyze when
+	// cfg.Threads > 1, which share our table.
+	helpers []*MinimaxAI
+	// The search mutates a single position in place with
+	// DoMove/UndoMove; each ply keeps the undo record for the
+	// move it is currently searching.
 	stack [maxDepth]struct {
-		p     *tak.Position
+		u     tak.Undo
 		mg    moveGenerator
 		moves [500]tak.Move
 		pv    [maxDepth]tak.Move
 		m     tak.Move
+		te    tableEntry
 	}
 
 	cancel *int32
@@ -55,15 +65,6 @@ type MinimaxAI struct {
 	Diversify int64
 }
 
-type tableEntry struct {
-	hash  uint64
-	depth int
-	value int64
-	bound boundType
-	m     tak.Move
-	p     *tak.Position
-}
-
 type boundType byte
 
 const (
@@ -93,6 +94,14 @@ type Stats struct {
 
 	TTHits     uint64
 	TTShortcut uint64
+	// TTPuts counts writes to the transposition table, and
+	// TTCollisions those that evicted an entry for another
+	// position written during the same call to Analyze.
+	TTPuts       uint64
+	TTCollisions uint64
+	// TTFill is the permille of the transposition table holding
+	// entries written during the current call to Analyze.
+	TTFill int
 }
 
 type MinimaxConfig struct {
@@ -105,10 +114,36 @@ type MinimaxConfig struct {
 	NoTable    bool
 	NoNullMove bool
 
+	// TableMB is the size of the transposition table in
+	// megabytes; if zero, the table holds 1<<20 entries (24MB).
+	TableMB int
+
+	// Threads is the number of searches Analyze runs in parallel,
+	// sharing one transposition table. The extra searches only
+	// fill the table for the main one, whose result is returned.
+	Threads int
+
 	Evaluate EvaluationFunc
+
+	// Progress, if set, is called by Analyze as each depth of the
+	// search completes, with its value and principal variation.
+	Progress func(depth int, value int64, pv []tak.Move, st Stats)
 }
 
 func NewMinimax(cfg MinimaxConfig) *MinimaxAI {
+	m := newMinimax(cfg)
+	if !cfg.NoTable {
+		m.table = newTable(tableEntries(cfg.TableMB))
+	}
+	for i := 1; i < cfg.Threads; i++ {
+		h := newMinimax(cfg)
+		h.table = m.table
+		m.helpers = append(m.helpers, h)
+	}
+	return m
+}
+
+func newMinimax(cfg MinimaxConfig) *MinimaxAI {
 	m := &MinimaxAI{cfg: cfg}
 	if m.cfg.Depth == 0 {
 		m.cfg.Depth = maxDepth
@@ -120,12 +155,6 @@ func NewMinimax(cfg MinimaxConfig) *MinimaxAI {
 	}
 	m.history = make(map[uint64]int, m.cfg.Size*m.cfg.Size*m.cfg.Size)
 	m.response = make(map[uint64]tak.Move, m.cfg.Size*m.cfg.Size*m.cfg.Size)
-	if !cfg.NoTable {
-		m.table = make([]tableEntry, tableSize)
-	}
-	for i := range m.stack {
-		m.stack[i].p = tak.Alloc(m.cfg.Size)
-	}
 
 	var seed = m.cfg.Seed
 	if seed == 0 {
@@ -138,36 +167,29 @@ func NewMinimax(cfg MinimaxConfig) *MinimaxAI {
 
 const hashMul = 0x61C8864680B583EB
 
-func (m *MinimaxAI) ttGet(h uint64) *tableEntry {
+// ttGet looks up hash `h` in the table, decoding the entry into
+// `te`, which it returns, or nil if there is none.
+func (m *MinimaxAI) ttGet(h uint64, te *tableEntry) *tableEntry {
 	if m.cfg.NoTable {
 		return nil
 	}
-	i1 := h % tableSize
-	i2 := (h * hashMul) % tableSize
-	te := &m.table[i1]
-	if te.hash == h {
-		return te
-	}
-	te = &m.table[i2]
-	if te.hash == h {
-		return te
+	if !m.table.get(h, te) {
+		return nil
 	}
-	return nil
+	return te
 }
 
-func (m *MinimaxAI) ttPut(h uint64) *tableEntry {
+func (m *MinimaxAI) ttPut(te *tableEntry) {
 	if m.cfg.NoTable {
-		return nil
+		return
 	}
 	if atomic.LoadInt32(m.cancel) != 0 {
-		return nil
+		return
 	}
-	i1 := h % tableSize
-	i2 := (h * hashMul) % tableSize
-	if m.table[i1].hash != 0 {
-		m.table[i2] = m.table[i1]
+	m.st.TTPuts++
+	if m.table.put(te) {
+		m.st.TTCollisions++
 	}
-	return &m.table[i1]
 }
 
 func (m *MinimaxAI) precompute() {
@@ -188,90 +210,14 @@ func formatpv(ms []tak.Move) string {
 	return out.String()
 }
 
-func getThreats(p *tak.Position) ([]tak.Move){
-	var threatpos *tak.Position = p.Clone()
-	size2 := p.Size() * p.Size()
-	var filtermask uint64
-	if p.ToMove() == tak.White {
-		filtermask = p.White
-		threatpos.White = 0
-	} else {
-		filtermask = p.Black
-		threatpos.Black = 0
-	}
-	threatpos.Caps &^= filtermask
-	threatpos.Standing &^= filtermask
-	for spot := 0; spot < size2; spot++ {
-		var spotmask uint64 = 1 << uint(spot)
-		if spotmask&filtermask != 0 {
-			threatpos.Height[spot] = 0
-			threatpos.Stacks[spot] = 0
-		}
-	}
-	threatpos.IncrementMove()
-	threatmoves := []tak.Move{}
-	allmoves := []tak.Move{}
-	allmoves = threatpos.AllMoves(allmoves)
-	var searchpos *tak.Position
-	var err error
-	for _, move := range allmoves {
-		if move.Type >= tak.SlideLeft {
-			//searchpos = threatpos.Clone()
-			searchpos, err = threatpos.MovePreallocated(&move, searchpos)
-			if err == nil {
-				over, winner := searchpos.GameOver()
-				if over && threatpos.ToMove() == winner {
-					threatmoves = append(threatmoves, move)
-				}
-			}
-		}
-	}
-	return threatmoves
-}
-
 func (m *MinimaxAI) GetMove1(ctx context.Context, p *tak.Position, spread float64) (tak.Move, float64) {
 	if m.cfg.Size != p.Size() {
 		panic("Analyze: wrong size")
 	}
-	var threatpos *tak.Position = p.Clone()
-	size2 := p.Size() * p.Size()
-	var filtermask uint64
-	if p.ToMove() == tak.White {
-		filtermask = p.White
-		threatpos.White = 0
-	} else {
-		filtermask = p.Black
-		threatpos.Black = 0
-	}
-	threatpos.Caps &^= filtermask
-	threatpos.Standing &^= filtermask
-	for spot := 0; spot < size2; spot++ {
-		var spotmask uint64 = 1 << uint(spot)
-		if spotmask&filtermask != 0 {
-			threatpos.Height[spot] = 0
-			threatpos.Stacks[spot] = 0
-		}
-	}
-	threatpos.IncrementMove()
-	threatmoves := []tak.Move{}
 	allmoves := []tak.Move{}
-	allmoves = threatpos.AllMoves(allmoves)
+	allmoves = p.LegalMoves(allmoves)
 	var searchpos *tak.Position
 	var err error
-	for _, move := range allmoves {
-		if move.Type >= tak.SlideLeft {
-			//searchpos = threatpos.Clone()
-			searchpos, err = threatpos.MovePreallocated(&move, searchpos)
-			if err == nil {
-				over, winner := searchpos.GameOver()
-				if over && threatpos.ToMove() == winner {
-					threatmoves = append(threatmoves, move)
-				}
-			}
-		}
-	}
-	allmoves = []tak.Move{}
-	allmoves = p.AllMoves(allmoves)
 	allmovesvalue := []float64{}
 	movecount := float64(0)
 	valuesum := int64(0)
@@ -282,7 +228,6 @@ func (m *MinimaxAI) GetMove1(ctx context.Context, p *tak.Position, spread float6
 			//fmt.Printf("Illegal move found:\n%+v\n", err)
 			allmovesvalue = append(allmovesvalue, float64(Illegal))
 		} else {
-			searchpos.Threatmoves = threatmoves
 			value := -m.evaluate(m, searchpos)
 			allmovesvalue = append(allmovesvalue, float64(value))
 			deviationvalue := value
@@ -315,7 +260,6 @@ func (m *MinimaxAI) GetMove1(ctx context.Context, p *tak.Position, spread float6
 	}
 	//fmt.Printf("All moves values:\n%+v\n", allmovesvalue)
 	//fmt.Printf("Chosen move value:\n%+v\n", allmovesvalue[moveid])
-	//fmt.Printf("Threat moves:\n%+v\n", threatmoves)
 	return allmoves[moveid], movevalue
 }
 
@@ -326,7 +270,7 @@ func (m *MinimaxAI) GetMovex(ctx context.Context, p *tak.Position, depth int, sp
 		return retmove, -retvalue
 	} else {
 		allmoves := []tak.Move{}
-		allmoves = p.AllMoves(allmoves)
+		allmoves = p.LegalMoves(allmoves)
 		var searchpos *tak.Position
 		var err error
 		//allmovesvalue := []float64{}
@@ -401,6 +345,20 @@ func (m *MinimaxAI) Analyze(ctx context.Context, p *tak.Position) ([]tak.Move, i
 			p.MoveNumber(), p.ToMove(), seed)
 	}
 	deadline, limited := ctx.Deadline()
+	if m.table != nil {
+		m.table.newSearch()
+	}
+
+	var stop int32
+	var helpers sync.WaitGroup
+	for i, h := range m.helpers {
+		h.Diversify = m.Diversify
+		helpers.Add(1)
+		go func(i int, h *MinimaxAI) {
+			defer helpers.Done()
+			h.help(p, i+1, seed+int64(i+1), &stop)
+		}(i, h)
+	}
 
 	var next []tak.Move
 	ms := make([]tak.Move, 0, maxDepth)
@@ -409,30 +367,49 @@ func (m *MinimaxAI) Analyze(ctx context.Context, p *tak.Position) ([]tak.Move, i
 	var prevEval uint64
 	var branchSum uint64
 	base := 0
-	te := m.ttGet(p.Hash())
+	var rootEntry tableEntry
+	te := m.ttGet(p.Hash(), &rootEntry)
 	if te != nil && te.bound == exactBound {
 		base = te.depth
 		ms = append(ms[:0], te.m)
 	}
 
+	// the search works in place, so don't scribble on the caller's
+	// position
+	root := p.Clone()
+	// done holds the stats of the last depth that finished, which
+	// are what we report if the search is canceled
+	done := Stats{Depth: base}
 	for i := 1; i+base <= m.cfg.Depth; i++ {
 		m.st = Stats{Depth: i + base}
 		start := time.Now()
-		next, v = m.minimax(p, 0, i+base, ms, MinEval-1, MaxEval+1, 0)
+		var val int64
+		next, val = m.minimax(root, 0, i+base, ms, MinEval-1, MaxEval+1, 0)
 		if next == nil || atomic.LoadInt32(m.cancel) != 0 {
+			m.st = done
 			break
 		}
 		ms = append(ms[:0], next...)
+		v = val
+		if m.table != nil {
+			m.st.TTFill = m.table.fill()
+		}
+		if m.cfg.Progress != nil {
+			m.cfg.Progress(i+base, v, ms, m.st)
+		}
 		timeUsed := time.Now().Sub(top)
 		timeMove := time.Now().Sub(start)
 		if m.cfg.Debug > 0 {
-			log.Printf("[minimax] deepen: depth=%d val=%d pv=%s time=%s total=%s evaluated=%d tt=%d/%d branch=%d",
+			log.Printf("[minimax] deepen: depth=%d val=%d pv=%s time=%s total=%s evaluated=%d tt=%d/%d fill=%d collisions=%d/%d branch=%d",
 				base+i, v, formatpv(ms),
 				timeMove,
 				timeUsed,
 				m.st.Evaluated,
 				m.st.TTShortcut,
 				m.st.TTHits,
+				m.st.TTFill,
+				m.st.TTCollisions,
+				m.st.TTPuts,
 				m.st.Evaluated/(prevEval+1),
 			)
 		}
@@ -457,6 +434,7 @@ func (m *MinimaxAI) Analyze(ctx context.Context, p *tak.Position) ([]tak.Move, i
 			branchSum += m.st.Evaluated / (prevEval + 1)
 		}
 		prevEval = m.st.Evaluated
+		done = m.st
 		if v > WinThreshold || v < -WinThreshold {
 			break
 		}
@@ -484,7 +462,60 @@ func (m *MinimaxAI) Analyze(ctx context.Context, p *tak.Position) ([]tak.Move, i
 			}
 		}
 	}
-	return ms, v, m.st
+	atomic.StoreInt32(&stop, 1)
+	helpers.Wait()
+	st := m.st
+	for _, h := range m.helpers {
+		st.add(&h.st)
+	}
+	if m.table != nil {
+		st.TTFill = m.table.fill()
+	}
+	return ms, v, st
+}
+
+// help runs iterative deepening searches of `p` until `stop` is
+// set, to fill the table shared with the main search. Odd helpers
+// search one ply deeper than even ones, spreading the threads over
+// adjacent depths; each also orders the root moves differently.
+func (m *MinimaxAI) help(p *tak.Position, id int, seed int64, stop *int32) {
+	m.cancel = stop
+	m.rand = rand.New(rand.NewSource(seed))
+	for i, v := range m.history {
+		m.history[i] = v / 2
+	}
+	m.st = Stats{}
+	root := p.Clone()
+	pv := make([]tak.Move, 0, maxDepth)
+	for depth := 1 + id%2; depth <= m.cfg.Depth; depth++ {
+		next, _ := m.minimax(root, 0, depth, pv, MinEval-1, MaxEval+1, 0)
+		if next == nil || atomic.LoadInt32(stop) != 0 {
+			return
+		}
+		pv = append(pv[:0], next...)
+		m.st.Depth = depth
+	}
+}
+
+// add adds the counters in `o` to those in `s`.
+func (s *Stats) add(o *Stats) {
+	s.Generated += o.Generated
+	s.Evaluated += o.Evaluated
+	s.Scout += o.Scout
+	s.Terminal += o.Terminal
+	s.Visited += o.Visited
+	s.CutNodes += o.CutNodes
+	s.NullSearch += o.NullSearch
+	s.NullCut += o.NullCut
+	s.Cut0 += o.Cut0
+	s.Cut1 += o.Cut1
+	s.CutSearch += o.CutSearch
+	s.ReSearch += o.ReSearch
+	s.AllNodes += o.AllNodes
+	s.TTHits += o.TTHits
+	s.TTShortcut += o.TTShortcut
+	s.TTPuts += o.TTPuts
+	s.TTCollisions += o.TTCollisions
 }
 
 func (ai *MinimaxAI) minimax(
@@ -508,7 +539,7 @@ func (ai *MinimaxAI) minimax(
 		ai.st.Scout++
 	}
 
-	te := ai.ttGet(p.Hash())
+	te := ai.ttGet(p.Hash(), &ai.stack[ply].te)
 	if te != nil {
 		ai.st.TTHits++
 		teSuffices := false
@@ -525,8 +556,9 @@ func (ai *MinimaxAI) minimax(
 			teSuffices = true
 		}
 		if teSuffices {
-			_, e := p.MovePreallocated(&te.m, ai.stack[ply].p)
+			e := p.DoMove(&te.m, &ai.stack[ply].u)
 			if e == nil {
+				p.UndoMove(&ai.stack[ply].u)
 				ai.st.TTShortcut++
 				ai.stack[ply].pv[0] = te.m
 				return ai.stack[ply].pv[:1], te.value
@@ -537,13 +569,14 @@ func (ai *MinimaxAI) minimax(
 
 	if β == α+1 && ai.nullMoveOK(ply, depth, p) {
 		ai.stack[ply].m = tak.Move{Type: tak.Pass}
-		child, e := p.MovePreallocated(&ai.stack[ply].m, ai.stack[ply].p)
+		e := p.DoMove(&ai.stack[ply].m, &ai.stack[ply].u)
 		if e == nil {
 			ai.st.NullSearch++
 			if(diverseadd==0){
 				diverseaddvar = 1+ai.rand.Int63n(1+ai.Diversify)
 			}
-			_, v := ai.minimax(child, ply+1, depth-3, nil, -α-1, -α, diverseaddvar)
+			_, v := ai.minimax(p, ply+1, depth-3, nil, -α-1, -α, diverseaddvar)
+			p.UndoMove(&ai.stack[ply].u)
 			v = -v
 			if v >= β {
 				ai.st.NullCut++
@@ -569,11 +602,7 @@ func (ai *MinimaxAI) minimax(
 	best = append(best, pv...)
 	improved := false
 	var i int
-	var threats []tak.Move
-	if(depth==1){
-		threats = getThreats(p)
-	}
-	for m, child := mg.Next(); child != nil; m, child = mg.Next() {
+	for m, ok := mg.Next(); ok; m, ok = mg.Next() {
 		i++
 		var ms []tak.Move
 		var newpv []tak.Move
@@ -586,18 +615,16 @@ func (ai *MinimaxAI) minimax(
 		if(diverseadd==0){
 			diverseaddvar = 1+ai.rand.Int63n(1+ai.Diversify)
 		}
-		if(depth==1){
-			child.Threatmoves=threats
-		}
 		if i > 1 {
-			ms, v = ai.minimax(child, ply+1, depth-1, newpv, -α-1, -α, diverseaddvar)
+			ms, v = ai.minimax(p, ply+1, depth-1, newpv, -α-1, -α, diverseaddvar)
 			if -v > α && -v < β {
 				ai.st.ReSearch++
-				ms, v = ai.minimax(child, ply+1, depth-1, newpv, -β, -α, diverseaddvar)
+				ms, v = ai.minimax(p, ply+1, depth-1, newpv, -β, -α, diverseaddvar)
 			}
 		} else {
-			ms, v = ai.minimax(child, ply+1, depth-1, newpv, -β, -α, diverseaddvar)
+			ms, v = ai.minimax(p, ply+1, depth-1, newpv, -β, -α, diverseaddvar)
 		}
+		p.UndoMove(&ai.stack[ply].u)
 		v = -v
 
 		if len(best) == 0 {
@@ -642,20 +669,21 @@ func (ai *MinimaxAI) minimax(
 		}
 	}
 
-	if te = ai.ttPut(p.Hash()); te != nil {
-		te.hash = p.Hash()
-		te.depth = depth
-		te.m = best[0]
-		te.value = α
-		if !improved {
-			te.bound = upperBound
-			ai.st.AllNodes++
-		} else if α >= β {
-			te.bound = lowerBound
-		} else {
-			te.bound = exactBound
-		}
+	put := tableEntry{
+		hash:  p.Hash(),
+		depth: depth,
+		m:     best[0],
+		value: α,
+	}
+	if !improved {
+		put.bound = upperBound
+		ai.st.AllNodes++
+	} else if α >= β {
+		put.bound = lowerBound
+	} else {
+		put.bound = exactBound
 	}
+	ai.ttPut(&put)
 
 	return best, α
 }
@@ -75,15 +75,69 @@ func TestCancel(t *testing.T) {
 	}
 }
 
+func TestProgress(t *testing.T) {
+	var depths []int
+	var last []tak.Move
+	ai := NewMinimax(MinimaxConfig{
+		Size:  5,
+		Depth: 3,
+		Progress: func(depth int, v int64, pv []tak.Move, st Stats) {
+			depths = append(depths, depth)
+			last = append(last[:0], pv...)
+		},
+	})
+	p := tak.New(tak.Config{Size: 5})
+	pv, _, _ := ai.Analyze(context.Background(), p)
+	if len(depths) != 3 || depths[0] != 1 || depths[2] != 3 {
+		t.Fatalf("progress depths=%v", depths)
+	}
+	if len(last) == 0 || !last[0].Equal(&pv[0]) {
+		t.Fatalf("progress pv=%s, analyze pv=%s", formatpv(last), formatpv(pv))
+	}
+}
+
+func TestThreads(t *testing.T) {
+	p, e := ptn.ParseTPS("2,x4/x2,2,x2/x,2,2,x2/x,1,1,1,x/1,x4 1 5")
+	if e != nil {
+		t.Fatal(e)
+	}
+	single := NewMinimax(MinimaxConfig{Size: 5, Depth: 4, Seed: 1})
+	_, _, st1 := single.Analyze(context.Background(), p)
+	ai := NewMinimax(MinimaxConfig{Size: 5, Depth: 4, Seed: 1, Threads: 4})
+	for i := 0; i < 2; i++ {
+		pv, _, st := ai.Analyze(context.Background(), p)
+		if len(pv) == 0 {
+			t.Fatal("no pv")
+		}
+		if _, e := p.Move(&pv[0]); e != nil {
+			t.Fatalf("illegal move %s: %v", ptn.FormatMove(&pv[0]), e)
+		}
+		if st.Depth != 4 {
+			t.Fatalf("depth=%d", st.Depth)
+		}
+		if i == 0 && st.Visited+st.Evaluated <= st1.Visited+st1.Evaluated {
+			t.Fatalf("helper work not counted: %d <= %d",
+				st.Visited+st.Evaluated, st1.Visited+st1.Evaluated)
+		}
+	}
+}
+
 func TestRepeatedCancel(t *testing.T) {
 	type result struct {
 		ms []tak.Move
 		st Stats
 	}
 	ctx := context.Background()
-	ai := NewMinimax(MinimaxConfig{Size: 5, Depth: 6, NoNullMove: true, NoTable: true})
+	var last Stats
+	ai := NewMinimax(MinimaxConfig{
+		Size: 5, Depth: 6, NoNullMove: true, NoTable: true,
+		Progress: func(depth int, value int64, pv []tak.Move, st Stats) {
+			last = st
+		},
+	})
 	p := tak.New(tak.Config{Size: 5})
 	for i := 0; i < 5; i++ {
+		last = Stats{}
 		done := make(chan result)
 		start := make(chan struct{})
 		ctx, cancel := context.WithCancel(ctx)
@@ -102,6 +156,10 @@ func TestRepeatedCancel(t *testing.T) {
 		if len(res.ms) == 0 {
 			t.Fatalf("[%d] canceled search did not return a move", i)
 		}
+		if res.st != last {
+			t.Fatalf("[%d] canceled search reported %+v, last completed depth %+v",
+				i, res.st, last)
+		}
 	}
 	ms, _, st := ai.Analyze(ctx, p)
 	if len(ms) == 0 {
@@ -29,7 +29,11 @@ func (s sortMoves) Swap(i, j int) {
 	s.m.ms[i], s.m.ms[j] = s.m.ms[j], s.m.ms[i]
 }
 
-func (mg *moveGenerator) Next() (m tak.Move, p *tak.Position) {
+// Next applies the next legal move to mg.p in place, recording it
+// in the ply's undo record, and returns it. The caller must
+// UndoMove before calling Next again. ok is false once all moves
+// have been tried.
+func (mg *moveGenerator) Next() (m tak.Move, ok bool) {
 	for {
 		var m tak.Move
 		switch mg.i {
@@ -62,7 +66,7 @@ func (mg *moveGenerator) Next() (m tak.Move, p *tak.Position) {
 			fallthrough
 		case 3:
 			mg.i++
-			mg.ms = mg.p.AllMoves(mg.ai.stack[mg.ply].moves[:0])
+			mg.ms = mg.p.LegalMoves(mg.ai.stack[mg.ply].moves[:0])
 			if mg.ply == 0 {
 				for i := len(mg.ms) - 1; i > 0; i-- {
 					j := mg.ai.rand.Int31n(int32(i))
@@ -75,7 +79,7 @@ func (mg *moveGenerator) Next() (m tak.Move, p *tak.Position) {
 		default:
 			mg.i++
 			if len(mg.ms) == 0 {
-				return tak.Move{}, nil
+				return tak.Move{}, false
 			}
 			m = mg.ms[0]
 			mg.ms = mg.ms[1:]
@@ -86,9 +90,8 @@ func (mg *moveGenerator) Next() (m tak.Move, p *tak.Position) {
 				continue
 			}
 		}
-		child, e := mg.p.MovePreallocated(&m, mg.ai.stack[mg.ply].p)
-		if e == nil {
-			return m, child
+		if e := mg.p.DoMove(&m, &mg.ai.stack[mg.ply].u); e == nil {
+			return m, true
 		}
 	}
 }
@@ -13,7 +13,7 @@ type RandomAI struct {
 }
 
 func (r *RandomAI) GetMove(ctx context.Context, p *tak.Position) tak.Move {
-	moves := p.AllMoves(nil)
+	moves := p.LegalMoves(nil)
 	i := r.r.Int31n(int32(len(moves)))
 	return moves[i]
 }
@@ -0,0 +1,31 @@
+package ai
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"../ptn"
+	"../tak"
+)
+
+func TestRandomLegal(t *testing.T) {
+	for _, size := range []int{3, 4, 5, 6, 7, 8} {
+		r := NewRandom(int64(size))
+		for g := 0; g < 10; g++ {
+			p := tak.New(tak.Config{Size: size})
+			for ply := 0; ply < 300; ply++ {
+				if over, _ := p.GameOver(); over {
+					break
+				}
+				m := r.GetMove(context.Background(), p)
+				next, e := p.Move(&m)
+				if e != nil {
+					t.Fatalf("size=%d ply=%d: illegal move %s: %v",
+						size, ply, ptn.FormatMove(&m), e)
+				}
+				p = next
+			}
+		}
+	}
+}
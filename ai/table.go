@@ -0,0 +1,174 @@
+package ai
+
+import (
+	"sync/atomic"
+
+	"../tak"
+)
+
+const (
+	// slotBytes is the memory taken by each table entry.
+	slotBytes = 24
+	// fillSample is the number of slots table.fill examines.
+	fillSample = 1000
+)
+
+// A table is a transposition table which may be shared by searches
+// running concurrently. Entries are packed into three words, each
+// read and written atomically; the first holds the position's hash
+// xor the other two, so that an entry torn by racing writers fails
+// to match any hash and reads as empty.
+//
+// Each position may be stored in either of two slots. Entries
+// record the generation, counting calls to Analyze, in which they
+// were written, and when both slots are taken the one holding the
+// least valuable entry is replaced: an entry from an earlier
+// search before one from this search, and then the shallower.
+type table struct {
+	slots [][3]uint64
+	gen   uint32
+}
+
+type tableEntry struct {
+	hash  uint64
+	depth int
+	value int64
+	bound boundType
+	gen   uint8
+	m     tak.Move
+}
+
+// tableEntries returns the number of entries that fit in a table of
+// `mb` megabytes, or the default number if `mb` is 0.
+func tableEntries(mb int) uint64 {
+	if mb <= 0 {
+		return tableSize
+	}
+	n := (uint64(mb) << 20) / slotBytes
+	if n < 2 {
+		n = 2
+	}
+	return n
+}
+
+func newTable(size uint64) *table {
+	return &table{slots: make([][3]uint64, size)}
+}
+
+// newSearch starts a new generation, making the entries already in
+// the table the first to be replaced.
+func (t *table) newSearch() {
+	atomic.AddUint32(&t.gen, 1)
+}
+
+func (t *table) generation() uint8 {
+	return uint8(atomic.LoadUint32(&t.gen))
+}
+
+func (e *tableEntry) pack() (uint64, uint64) {
+	data := uint64(e.m.Pack()) |
+		uint64(e.depth)<<32 |
+		uint64(e.bound)<<40 |
+		uint64(e.gen)<<48
+	return data, uint64(e.value)
+}
+
+// peek reads slot `i` into `e` whatever position it holds, and
+// reports whether it holds any.
+func (t *table) peek(i uint64, e *tableEntry) bool {
+	s := &t.slots[i]
+	check := atomic.LoadUint64(&s[0])
+	data := atomic.LoadUint64(&s[1])
+	value := atomic.LoadUint64(&s[2])
+	e.hash = check ^ data ^ value
+	if e.hash == 0 {
+		return false
+	}
+	e.m = tak.UnpackMove(uint32(data))
+	e.depth = int(data >> 32 & 0xff)
+	e.bound = boundType(data >> 40 & 0x3)
+	e.gen = uint8(data >> 48)
+	e.value = int64(value)
+	return true
+}
+
+// load reads slot `i` into `e`, and reports whether it holds hash `h`.
+func (t *table) load(i, h uint64, e *tableEntry) bool {
+	return t.peek(i, e) && e.hash == h
+}
+
+func (t *table) store(i uint64, e *tableEntry) {
+	data, value := e.pack()
+	s := &t.slots[i]
+	atomic.StoreUint64(&s[1], data)
+	atomic.StoreUint64(&s[2], value)
+	atomic.StoreUint64(&s[0], e.hash^data^value)
+}
+
+func (t *table) index(h uint64) (uint64, uint64) {
+	n := uint64(len(t.slots))
+	return h % n, (h * hashMul) % n
+}
+
+// get looks up hash `h`, checking both of its slots, and decodes
+// the entry into `e`.
+func (t *table) get(h uint64, e *tableEntry) bool {
+	i1, i2 := t.index(h)
+	return t.load(i1, h, e) || t.load(i2, h, e)
+}
+
+// put stores `e` in one of its slots, and reports whether that
+// evicted an entry for another position written in this search.
+// An entry from this search for the same position is kept if it is
+// deeper, unless `e` is exact.
+func (t *table) put(e *tableEntry) (collision bool) {
+	e.gen = t.generation()
+	i1, i2 := t.index(e.hash)
+	slots := [2]uint64{i1, i2}
+	var old [2]tableEntry
+	var full [2]bool
+	for k, i := range slots {
+		full[k] = t.peek(i, &old[k])
+		if full[k] && old[k].hash == e.hash {
+			if old[k].gen != e.gen || old[k].depth <= e.depth || e.bound == exactBound {
+				t.store(i, e)
+			}
+			return false
+		}
+	}
+	victim := -1
+	worst := 0
+	for k := range slots {
+		if !full[k] {
+			t.store(slots[k], e)
+			return false
+		}
+		score := old[k].depth
+		if old[k].gen == e.gen {
+			score += maxDepth + 1
+		}
+		if victim < 0 || score < worst {
+			victim, worst = k, score
+		}
+	}
+	t.store(slots[victim], e)
+	return old[victim].gen == e.gen
+}
+
+// fill returns the permille of a sample of the table holding
+// entries from this search.
+func (t *table) fill() int {
+	n := fillSample
+	if n > len(t.slots) {
+		n = len(t.slots)
+	}
+	gen := t.generation()
+	used := 0
+	var e tableEntry
+	for i := 0; i < n; i++ {
+		if t.peek(uint64(i), &e) && e.gen == gen {
+			used++
+		}
+	}
+	return used * 1000 / n
+}
@@ -0,0 +1,105 @@
+package ai
+
+import (
+	"sync"
+	"testing"
+
+	"../ptn"
+	"../tak"
+)
+
+func TestTable(t *testing.T) {
+	m, e := ptn.ParseMove("3c3>111")
+	if e != nil {
+		t.Fatal(e)
+	}
+	tt := newTable(16)
+	in := tableEntry{hash: 0x1234, depth: 7, value: -WinThreshold - 5, bound: lowerBound, m: m}
+	tt.put(&in)
+	var out tableEntry
+	if !tt.get(in.hash, &out) {
+		t.Fatal("entry not found")
+	}
+	if out.hash != in.hash || out.depth != in.depth || out.value != in.value ||
+		out.bound != in.bound || !out.m.Equal(&in.m) {
+		t.Fatalf("got %+v, want %+v", out, in)
+	}
+	if tt.get(0x4321, &out) {
+		t.Fatal("found a missing entry")
+	}
+}
+
+func TestTableConcurrent(t *testing.T) {
+	tt := newTable(64)
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			var out tableEntry
+			for i := 0; i < 10000; i++ {
+				h := uint64(i%100 + 1)
+				// every entry for hash h holds value h, so a
+				// torn read would show as a mismatch
+				tt.put(&tableEntry{hash: h, depth: w, value: int64(h), m: tak.Move{X: w, Type: tak.PlaceFlat}})
+				if tt.get(h, &out) && out.value != int64(h) {
+					t.Errorf("hash %d: value %d", h, out.value)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+func TestTableReplacement(t *testing.T) {
+	tt := newTable(tableEntries(1))
+	if n := uint64(len(tt.slots)); n != (1<<20)/slotBytes {
+		t.Fatalf("1MB table has %d entries", n)
+	}
+	tt = newTable(8)
+	// find positions which share both their slots
+	var hs []uint64
+	for h := uint64(1); len(hs) < 5; h++ {
+		i1, i2 := tt.index(h)
+		if i1 == 1 && i2 == 3 {
+			hs = append(hs, h)
+		}
+	}
+	deep := tableEntry{hash: hs[0], depth: 6, bound: exactBound, m: tak.Move{Type: tak.PlaceFlat}}
+	shallow := tableEntry{hash: hs[1], depth: 2, bound: exactBound, m: tak.Move{Type: tak.PlaceFlat}}
+	tt.put(&deep)
+	tt.put(&shallow)
+	if c := tt.put(&tableEntry{hash: hs[2], depth: 3, m: tak.Move{Type: tak.PlaceFlat}}); !c {
+		t.Fatal("eviction not reported as a collision")
+	}
+	var e tableEntry
+	if !tt.get(hs[0], &e) || tt.get(hs[1], &e) || !tt.get(hs[2], &e) {
+		t.Fatal("did not replace the shallower entry")
+	}
+	if fill := tt.fill(); fill != 250 {
+		t.Fatalf("fill=%d", fill)
+	}
+
+	// a shallower result for the same position keeps the deeper
+	tt.put(&tableEntry{hash: hs[0], depth: 1, bound: lowerBound, m: tak.Move{Type: tak.PlaceFlat}})
+	if !tt.get(hs[0], &e) || e.depth != 6 {
+		t.Fatalf("deep entry replaced: %+v", e)
+	}
+
+	// after a new search, old entries go first, however deep
+	tt.newSearch()
+	if fill := tt.fill(); fill != 0 {
+		t.Fatalf("fill=%d", fill)
+	}
+	if c := tt.put(&tableEntry{hash: hs[3], depth: 1, m: tak.Move{Type: tak.PlaceFlat}}); c {
+		t.Fatal("evicting a stale entry reported as a collision")
+	}
+	if !tt.get(hs[3], &e) || tt.get(hs[2], &e) || !tt.get(hs[0], &e) {
+		t.Fatal("did not replace the stale shallower entry")
+	}
+	tt.put(&tableEntry{hash: hs[4], depth: 1, m: tak.Move{Type: tak.PlaceFlat}})
+	if !tt.get(hs[3], &e) || tt.get(hs[0], &e) {
+		t.Fatal("did not replace the stale deep entry")
+	}
+}
@@ -1,5 +1,7 @@
 package bitboard
 
+import "math/bits"
+
 type Constants struct {
 	Size       uint
 	L, R, T, B uint64
@@ -20,14 +22,7 @@ func Precompute(size uint) Constants {
 }
 
 func Popcount(x uint64) int {
-	// bit population count, see
-	// http://graphics.stanford.edu/~seander/bithacks.html#CountBitsSetParallel
-	x -= (x >> 1) & 0x5555555555555555
-	x = (x>>2)&0x3333333333333333 + x&0x3333333333333333
-	x += x >> 4
-	x &= 0x0f0f0f0f0f0f0f0f
-	x *= 0x0101010101010101
-	return int(x >> 56)
+	return bits.OnesCount64(x)
 }
 
 func Flood(c *Constants, within uint64, seed uint64) uint64 {
@@ -77,7 +72,9 @@ func Dimensions(c *Constants, bits uint64) (w, h int) {
 		b >>= 1
 	}
 	for b != 0 && bits&b != 0 {
-		b >>= 1
+		// shifting the first column right would wrap it onto
+		// the last column of the row below
+		b = (b >> 1) &^ c.L
 		w++
 	}
 	b = c.T
@@ -90,3 +87,28 @@ func Dimensions(c *Constants, bits uint64) (w, h int) {
 	}
 	return w, h
 }
+
+// Row returns the squares in row `y`.
+func Row(c *Constants, y uint) uint64 {
+	return c.B << (y * c.Size)
+}
+
+// Column returns the squares in column `x`.
+func Column(c *Constants, x uint) uint64 {
+	return c.R << x
+}
+
+// Ray returns the squares beyond (x, y) in the direction (dx, dy),
+// up to the edge of the board. (x, y) itself is not included.
+func Ray(c *Constants, x, y, dx, dy int) uint64 {
+	var out uint64
+	size := int(c.Size)
+	for {
+		x += dx
+		y += dy
+		if x < 0 || y < 0 || x >= size || y >= size {
+			return out
+		}
+		out |= 1 << uint(y*size+x)
+	}
+}
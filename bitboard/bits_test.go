@@ -1,6 +1,7 @@
 package bitboard
 
 import (
+	"math/rand"
 	"strconv"
 	"testing"
 )
@@ -92,3 +93,206 @@ func TestDimensions(t *testing.T) {
 	}
 
 }
+
+// The tests below check the bitboard routines against a naive
+// implementation on a [y][x]bool grid, for every board size.
+
+type grid [][]bool
+
+func toGrid(size int, bits uint64) grid {
+	g := make(grid, size)
+	for y := range g {
+		g[y] = make([]bool, size)
+		for x := range g[y] {
+			g[y][x] = bits&(1<<uint(y*size+x)) != 0
+		}
+	}
+	return g
+}
+
+func (g grid) bits() uint64 {
+	var out uint64
+	for y := range g {
+		for x := range g[y] {
+			if g[y][x] {
+				out |= 1 << uint(y*len(g)+x)
+			}
+		}
+	}
+	return out
+}
+
+func (g grid) at(x, y int) bool {
+	return x >= 0 && y >= 0 && x < len(g) && y < len(g) && g[y][x]
+}
+
+func naiveGrow(size int, within, seed uint64) uint64 {
+	s, w := toGrid(size, seed), toGrid(size, within)
+	out := toGrid(size, 0)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			out[y][x] = w[y][x] && (s.at(x, y) ||
+				s.at(x-1, y) || s.at(x+1, y) ||
+				s.at(x, y-1) || s.at(x, y+1))
+		}
+	}
+	return out.bits()
+}
+
+func naiveGroups(size int, bits uint64) []uint64 {
+	g := toGrid(size, bits)
+	seen := toGrid(size, 0)
+	var out []uint64
+	for i := 0; i < size*size; i++ {
+		x, y := i%size, i/size
+		if !g[y][x] || seen[y][x] {
+			continue
+		}
+		group := toGrid(size, 0)
+		n := 0
+		stack := [][2]int{{x, y}}
+		seen[y][x] = true
+		for len(stack) > 0 {
+			sq := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			group[sq[1]][sq[0]] = true
+			n++
+			for _, d := range [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+				nx, ny := sq[0]+d[0], sq[1]+d[1]
+				if g.at(nx, ny) && !seen[ny][nx] {
+					seen[ny][nx] = true
+					stack = append(stack, [2]int{nx, ny})
+				}
+			}
+		}
+		if n > 1 {
+			out = append(out, group.bits())
+		}
+	}
+	return out
+}
+
+func naiveDimensions(size int, bits uint64) (w, h int) {
+	if bits == 0 {
+		return 0, 0
+	}
+	g := toGrid(size, bits)
+	minX, maxX, minY, maxY := size, -1, size, -1
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if !g[y][x] {
+				continue
+			}
+			if x < minX {
+				minX = x
+			}
+			if x > maxX {
+				maxX = x
+			}
+			if y < minY {
+				minY = y
+			}
+			if y > maxY {
+				maxY = y
+			}
+		}
+	}
+	return maxX - minX + 1, maxY - minY + 1
+}
+
+// randomBoard returns a random subset of the board, of a density
+// that varies between calls so that both sparse boards and large,
+// board-spanning groups occur.
+func randomBoard(r *rand.Rand, c *Constants) uint64 {
+	density := r.Intn(8)
+	var out uint64
+	for i := uint(0); i < c.Size*c.Size; i++ {
+		if r.Intn(8) < density {
+			out |= 1 << i
+		}
+	}
+	return out
+}
+
+func TestPrecomputeNaive(t *testing.T) {
+	for size := 3; size <= 8; size++ {
+		c := Precompute(uint(size))
+		var l, r, b, tp, mask grid
+		l, r, b, tp, mask = toGrid(size, 0), toGrid(size, 0),
+			toGrid(size, 0), toGrid(size, 0), toGrid(size, 0)
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				mask[y][x] = true
+				r[y][x] = x == 0
+				l[y][x] = x == size-1
+				b[y][x] = y == 0
+				tp[y][x] = y == size-1
+			}
+		}
+		if c.L != l.bits() || c.R != r.bits() ||
+			c.B != b.bits() || c.T != tp.bits() || c.Mask != mask.bits() {
+			t.Errorf("Precompute(%d)=%#v", size, c)
+		}
+	}
+}
+
+func TestGrowNaive(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for size := 3; size <= 8; size++ {
+		c := Precompute(uint(size))
+		for i := 0; i < 1000; i++ {
+			within, seed := randomBoard(r, &c), randomBoard(r, &c)
+			got := Grow(&c, within, seed)
+			want := naiveGrow(size, within, seed)
+			if got != want {
+				t.Fatalf("Grow[%d](%x, %x)=%x want %x",
+					size, within, seed, got, want)
+			}
+		}
+	}
+}
+
+func TestFloodGroupsNaive(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for size := 3; size <= 8; size++ {
+		c := Precompute(uint(size))
+		for i := 0; i < 1000; i++ {
+			bits := randomBoard(r, &c)
+			got := FloodGroups(&c, bits, nil)
+			want := naiveGroups(size, bits)
+			if len(got) != len(want) {
+				t.Fatalf("FloodGroups[%d](%x)=%x want %x",
+					size, bits, got, want)
+			}
+			for j := range got {
+				if got[j] != want[j] {
+					t.Fatalf("FloodGroups[%d](%x)=%x want %x",
+						size, bits, got, want)
+				}
+				w, h := Dimensions(&c, got[j])
+				ww, wh := naiveDimensions(size, got[j])
+				if w != ww || h != wh {
+					t.Fatalf("Dimensions[%d](%x)=(%d,%d) want (%d,%d)",
+						size, got[j], w, h, ww, wh)
+				}
+			}
+		}
+	}
+}
+
+func TestPopcountNaive(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	for i := 0; i < 1000; i++ {
+		x := r.Uint64()
+		if i == 0 {
+			x = ^uint64(0)
+		}
+		n := 0
+		for b := x; b != 0; b >>= 1 {
+			n += int(b & 1)
+		}
+		if got := Popcount(x); got != n {
+			t.Fatalf("Popcount(%x)=%d want %d", x, got, n)
+		}
+	}
+}
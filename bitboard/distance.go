@@ -0,0 +1,133 @@
+package bitboard
+
+import "math/bits"
+
+// Unreachable is the distance reported for squares no path reaches
+// within the limit.
+const Unreachable = 0xff
+
+// maxLevels is enough search levels to count placements across an
+// 8x8 board without allocating.
+const maxLevels = 64 + 1
+
+// Costs gives the cost of passing through each square for the
+// distance functions: a square in Costs[k] costs k, and a square in
+// none of them cannot be passed through. The sets must be disjoint.
+type Costs []uint64
+
+// PlacementCosts returns the Costs that count placements: `own`
+// squares are free and `empty` ones cost one.
+func PlacementCosts(own, empty uint64) Costs {
+	return Costs{own, empty}
+}
+
+func (cs Costs) of(bit uint64) int {
+	for k, s := range cs {
+		if s&bit != 0 {
+			return k
+		}
+	}
+	return Unreachable
+}
+
+// reach returns, for k = 0, 1, ..., limit, the set of squares some
+// path from `edge` reaches at a total cost of at most k, counting
+// both ends.
+//
+// It is a breadth-first search in which each level is a bitboard:
+// the squares first reached at cost k are those of cost j next to
+// a square reached at cost k-j (or on `edge`), flooded out through
+// the free squares.
+func reach(c *Constants, costs Costs, edge uint64, limit int, levels []uint64) []uint64 {
+	var all uint64
+	for _, s := range costs {
+		all |= s
+	}
+	// the most expensive square in `costs` can be entered from a
+	// level this far back
+	back := len(costs) - 1
+	levels = levels[:0]
+	for k := 0; k <= limit; k++ {
+		var seed uint64
+		if k > 0 {
+			seed = levels[k-1]
+		}
+		if k < len(costs) {
+			seed |= costs[k] & edge
+		}
+		for j := 1; j <= back && j <= k; j++ {
+			seed |= costs[j] & Grow(c, c.Mask, levels[k-j])
+		}
+		levels = append(levels, Flood(c, costs[0]|seed, seed))
+		if levels[k] == all || (k >= back && levels[k] == levels[k-back]) {
+			break
+		}
+	}
+	return levels
+}
+
+// Distances fills `out` with the cost of the cheapest path from a
+// square in `edge` to each square, counting both ends, or with
+// Unreachable if that exceeds `limit`.
+func Distances(c *Constants, costs Costs, edge uint64, limit int, out []uint8) []uint8 {
+	n := int(c.Size * c.Size)
+	out = fill(out, n)
+	var buf [maxLevels]uint64
+	levels := reach(c, costs, edge, limit, buf[:0])
+	for k := len(levels) - 1; k >= 0; k-- {
+		for b := levels[k]; b != 0; b &= b - 1 {
+			out[index(b&-b)] = uint8(k)
+		}
+	}
+	return out
+}
+
+// RoadDistances fills `out` with, for each square, the cost of the
+// cheapest path joining `from` to `to` through that square, or with
+// Unreachable if that exceeds `limit`.
+func RoadDistances(c *Constants, costs Costs, from, to uint64, limit int, out []uint8) []uint8 {
+	n := int(c.Size * c.Size)
+	var abuf, bbuf [64]uint8
+	a := Distances(c, costs, from, limit, abuf[:0])
+	b := Distances(c, costs, to, limit, bbuf[:0])
+	out = fill(out, n)
+	for i := 0; i < n; i++ {
+		if a[i] == Unreachable || b[i] == Unreachable {
+			continue
+		}
+		d := int(a[i]) + int(b[i]) - costs.of(1<<uint(i))
+		if d <= limit {
+			out[i] = uint8(d)
+		}
+	}
+	return out
+}
+
+// RoadDistance returns the fewest placements that would join `from`
+// to `to` through `own` and `empty` squares, or Unreachable if there
+// is no such path.
+func RoadDistance(c *Constants, own, empty, from, to uint64) int {
+	var buf [maxLevels]uint64
+	levels := reach(c, PlacementCosts(own, empty), from, int(c.Size*c.Size), buf[:0])
+	for k, l := range levels {
+		if l&to != 0 {
+			return k
+		}
+	}
+	return Unreachable
+}
+
+func fill(out []uint8, n int) []uint8 {
+	if cap(out) < n {
+		out = make([]uint8, n)
+	}
+	out = out[:n]
+	for i := range out {
+		out[i] = Unreachable
+	}
+	return out
+}
+
+func index(bit uint64) int {
+	return bits.TrailingZeros64(bit)
+}
@@ -0,0 +1,203 @@
+package bitboard
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// naiveDistances runs Dijkstra's algorithm over the squares,
+// charging each square's cost on entry.
+func naiveDistances(size int, costs Costs, edge uint64) []int {
+	const inf = 1 << 30
+	n := size * size
+	cost := make([]int, n)
+	dist := make([]int, n)
+	done := make([]bool, n)
+	for i := range cost {
+		cost[i] = -1
+		for k, s := range costs {
+			if s&(1<<uint(i)) != 0 {
+				cost[i] = k
+			}
+		}
+		dist[i] = inf
+		if cost[i] >= 0 && edge&(1<<uint(i)) != 0 {
+			dist[i] = cost[i]
+		}
+	}
+	for {
+		best := -1
+		for i := range dist {
+			if !done[i] && dist[i] < inf && (best < 0 || dist[i] < dist[best]) {
+				best = i
+			}
+		}
+		if best < 0 {
+			break
+		}
+		done[best] = true
+		x, y := best%size, best/size
+		for _, d := range [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+			nx, ny := x+d[0], y+d[1]
+			if nx < 0 || ny < 0 || nx >= size || ny >= size {
+				continue
+			}
+			j := ny*size + nx
+			if cost[j] >= 0 && dist[best]+cost[j] < dist[j] {
+				dist[j] = dist[best] + cost[j]
+			}
+		}
+	}
+	for i := range dist {
+		if dist[i] == inf {
+			dist[i] = Unreachable
+		}
+	}
+	return dist
+}
+
+func randomCosts(r *rand.Rand, c *Constants) Costs {
+	costs := make(Costs, 1+r.Intn(5))
+	for i := uint(0); i < c.Size*c.Size; i++ {
+		k := r.Intn(len(costs) + 1)
+		if k < len(costs) {
+			costs[k] |= 1 << i
+		}
+	}
+	return costs
+}
+
+func TestDistancesNaive(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	for size := 3; size <= 8; size++ {
+		c := Precompute(uint(size))
+		edges := []uint64{c.L, c.R, c.T, c.B}
+		for i := 0; i < 500; i++ {
+			costs := randomCosts(r, &c)
+			edge := edges[i%len(edges)]
+			limit := r.Intn(3 * size)
+			got := Distances(&c, costs, edge, limit, nil)
+			want := naiveDistances(size, costs, edge)
+			for sq := range got {
+				w := want[sq]
+				if w > limit {
+					w = Unreachable
+				}
+				if int(got[sq]) != w {
+					t.Fatalf("size=%d costs=%x edge=%x limit=%d: sq %d = %d want %d",
+						size, costs, edge, limit, sq, got[sq], w)
+				}
+			}
+		}
+	}
+}
+
+func TestRoadDistancesNaive(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+	for size := 3; size <= 8; size++ {
+		c := Precompute(uint(size))
+		for i := 0; i < 500; i++ {
+			costs := randomCosts(r, &c)
+			from, to := c.B, c.T
+			if i%2 == 1 {
+				from, to = c.R, c.L
+			}
+			limit := 2 * size
+			got := RoadDistances(&c, costs, from, to, limit, nil)
+			a := naiveDistances(size, costs, from)
+			b := naiveDistances(size, costs, to)
+			for sq := range got {
+				w := Unreachable
+				if a[sq] != Unreachable && b[sq] != Unreachable {
+					w = a[sq] + b[sq] - costs.of(1<<uint(sq))
+				}
+				if w > limit {
+					w = Unreachable
+				}
+				if int(got[sq]) != w {
+					t.Fatalf("size=%d costs=%x: sq %d = %d want %d",
+						size, costs, sq, got[sq], w)
+				}
+			}
+		}
+	}
+}
+
+func TestRoadDistance(t *testing.T) {
+	r := rand.New(rand.NewSource(6))
+	for size := 3; size <= 8; size++ {
+		c := Precompute(uint(size))
+		for i := 0; i < 500; i++ {
+			own, other := randomBoard(r, &c), randomBoard(r, &c)
+			other &^= own
+			empty := c.Mask &^ (own | other)
+			got := RoadDistance(&c, own, empty, c.B, c.T)
+			d := naiveDistances(size, PlacementCosts(own, empty), c.B)
+			want := Unreachable
+			for x := 0; x < size; x++ {
+				if v := d[(size-1)*size+x]; v < want {
+					want = v
+				}
+			}
+			if got != want {
+				t.Fatalf("size=%d own=%x empty=%x: %d want %d",
+					size, own, empty, got, want)
+			}
+		}
+	}
+
+	c := Precompute(5)
+	if d := RoadDistance(&c, 0, c.Mask, c.B, c.T); d != 5 {
+		t.Errorf("empty board: %d", d)
+	}
+	if d := RoadDistance(&c, Column(&c, 2), c.Mask&^Column(&c, 2), c.B, c.T); d != 0 {
+		t.Errorf("complete road: %d", d)
+	}
+}
+
+func TestLines(t *testing.T) {
+	for size := 3; size <= 8; size++ {
+		c := Precompute(uint(size))
+		for i := 0; i < size; i++ {
+			row, col := toGrid(size, 0), toGrid(size, 0)
+			for j := 0; j < size; j++ {
+				row[i][j] = true
+				col[j][i] = true
+			}
+			if got := Row(&c, uint(i)); got != row.bits() {
+				t.Errorf("Row[%d](%d)=%x", size, i, got)
+			}
+			if got := Column(&c, uint(i)); got != col.bits() {
+				t.Errorf("Column[%d](%d)=%x", size, i, got)
+			}
+		}
+		for x := 0; x < size; x++ {
+			for y := 0; y < size; y++ {
+				for _, d := range [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}, {1, 1}} {
+					want := toGrid(size, 0)
+					for k := 1; ; k++ {
+						nx, ny := x+k*d[0], y+k*d[1]
+						if nx < 0 || ny < 0 || nx >= size || ny >= size {
+							break
+						}
+						want[ny][nx] = true
+					}
+					if got := Ray(&c, x, y, d[0], d[1]); got != want.bits() {
+						t.Errorf("Ray[%d](%d,%d,%v)=%x", size, x, y, d, got)
+					}
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkRoadDistances(b *testing.B) {
+	r := rand.New(rand.NewSource(7))
+	c := Precompute(6)
+	costs := randomCosts(r, &c)
+	var out [64]uint8
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		RoadDistances(&c, costs, c.B, c.T, 6, out[:0])
+	}
+}
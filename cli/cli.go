@@ -13,56 +13,78 @@ type Player interface {
 	GetMove(p *tak.Position) tak.Move
 }
 
+// defaultMaxPlies is the ply limit used if CLI.MaxPlies is unset.
+const defaultMaxPlies = 200
+
 type CLI struct {
-	moves []tak.Move
-	p     *tak.Position
+	g *tak.Game
+	p *tak.Position
 
 	Config tak.Config
 	Out    io.Writer
 	White  Player
 	Black  Player
+
+	// MaxPlies is the number of plies after which the game is
+	// drawn; if zero, defaultMaxPlies is used.
+	MaxPlies int
 	
 	Silent bool
 }
 
 func (c *CLI) Play() *tak.Position {
-	c.moves = nil
 	c.p = tak.New(c.Config)
+	c.g = tak.NewGame(c.p)
+	c.g.MaxPlies = c.MaxPlies
+	if c.g.MaxPlies == 0 {
+		c.g.MaxPlies = defaultMaxPlies
+	}
 	for {
 		if !c.Silent {
 			c.render()
 		}
-		if ok, _ := c.p.GameOver(); ok {
-			d := c.p.WinDetails()
+		if ok, _ := c.g.GameOver(); ok {
+			d := c.g.WinDetails()
 			if !c.Silent {
 				fmt.Fprintf(c.Out, "Game Over! ")
 				if d.Winner == tak.NoColor {
-					fmt.Fprintf(c.Out, "Draw.")
+					fmt.Fprintf(c.Out, "Draw")
+					switch d.Reason {
+					case tak.RepetitionDraw:
+						fmt.Fprintf(c.Out, " by repetition")
+					case tak.PlyLimitDraw:
+						fmt.Fprintf(c.Out, " by ply limit")
+					}
+					fmt.Fprintf(c.Out, ".")
 				} else {
 					fmt.Fprintf(c.Out, "%s wins by ", d.Winner)
 					switch d.Reason {
 					case tak.RoadWin:
 						fmt.Fprintf(c.Out, "building a road")
+						if len(d.Roads) > 0 {
+							fmt.Fprintf(c.Out, " (%s)", ptn.FormatRoad(&d.Roads[0]))
+						}
 					case tak.FlatsWin:
 						fmt.Fprintf(c.Out, "flats count")
 					}
 				}
-				fmt.Fprintf(c.Out, "\nflats count: white=%d black=%d\n",
+				fmt.Fprintf(c.Out, "\nflats count: white=%d black=%d",
 					d.WhiteFlats,
 					d.BlackFlats)
+				if d.HalfKomi != 0 {
+					fmt.Fprintf(c.Out, " komi=%s", ptn.FormatKomi(d.HalfKomi))
+				}
+				fmt.Fprintf(c.Out, "\n")
 			}
 			return c.p
 		}
-		if c.p.MoveNumber()>200{
-			return c.p
-		}
 		var m tak.Move
 		if c.p.ToMove() == tak.White {
 			m = c.White.GetMove(c.p)
 		} else {
 			m = c.Black.GetMove(c.p)
 		}
-		p, e := c.p.Move(&m)
+		p, e := c.g.Move(&m)
 		if e != nil {
 			fmt.Fprintln(c.Out, "illegal move:", e)
 		} else {
@@ -74,13 +96,20 @@ func (c *CLI) Play() *tak.Position {
 				}
 			}
 			c.p = p
-			c.moves = append(c.moves, m)
 		}
 	}
 }
 
 func (c *CLI) Moves() []tak.Move {
-	return c.moves
+	if c.g == nil {
+		return nil
+	}
+	return c.g.Moves
+}
+
+// Game returns the game being played, including its history.
+func (c *CLI) Game() *tak.Game {
+	return c.g
 }
 
 func (c *CLI) render() {
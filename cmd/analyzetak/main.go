@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"runtime/pprof"
@@ -22,6 +23,8 @@ var (
 	quiet   = flag.Bool("quiet", false, "don't print board diagrams")
 	explain = flag.Bool("explain", false, "explain scoring")
 
+	annotate = flag.String("annotate", "", "analyze every move and write the game with eval comments to this PTN file")
+
 	move  = flag.Int("move", 0, "PTN move number to analyze")
 	final = flag.Bool("final", true, "analyze final position only")
 	black = flag.Bool("black", false, "only analyze black's move")
@@ -35,6 +38,8 @@ var (
 	sort     = flag.Bool("sort", true, "sort moves via history heuristic")
 	table    = flag.Bool("table", true, "use the transposition table")
 	nullMove = flag.Bool("nullMove", true, "use null-move pruning")
+	threads  = flag.Int("threads", 1, "number of parallel search threads")
+	tableMB  = flag.Int("table-mb", 0, "transposition table size in megabytes (0 for the default)")
 
 	cpuProfile = flag.String("cpuprofile", "", "write CPU profile")
 )
@@ -61,6 +66,9 @@ func main() {
 	case *move != 0:
 		color = tak.White
 	}
+	if *annotate != "" && *move != 0 {
+		log.Fatal("-annotate and -move are exclusive")
+	}
 
 	if *cpuProfile != "" {
 		f, e := os.OpenFile(*cpuProfile, os.O_WRONLY|os.O_CREATE, 0644)
@@ -71,7 +79,7 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
-	if *move != 0 || *final {
+	if *annotate == "" && (*move != 0 || *final) {
 		p, e := parsed.PositionAtMove(*move, color)
 		if e != nil {
 			log.Fatal("find move:", e)
@@ -84,18 +92,34 @@ func main() {
 			log.Fatal("initial:", e)
 		}
 		w, b := makeAI(p), makeAI(p)
+		out := &ptn.PTN{Tags: parsed.Tags}
+		// fresh is set if the last move has a new eval comment,
+		// which replaces any it had
+		fresh := false
 		for _, o := range parsed.Ops {
+			if c, ok := o.(*ptn.Comment); ok && fresh {
+				if _, e := c.Eval(); e == nil {
+					continue
+				}
+			}
+			out.Ops = append(out.Ops, o)
 			m, ok := o.(*ptn.Move)
 			if !ok {
 				continue
 			}
+			fresh = false
+			var ev *ptn.Eval
 			switch {
 			case p.ToMove() == tak.White && color != tak.Black:
 				log.Printf("%d. %s", p.MoveNumber()/2+1, ptn.FormatMove(&m.Move))
-				analyzeWith(w, p)
+				ev = analyzeWith(w, p)
 			case p.ToMove() == tak.Black && color != tak.White:
 				log.Printf("%d. ... %s", p.MoveNumber()/2+1, ptn.FormatMove(&m.Move))
-				analyzeWith(b, p)
+				ev = analyzeWith(b, p)
+			}
+			if ev != nil {
+				out.Ops = append(out.Ops, &ptn.Comment{Comment: ptn.FormatEval(ev)})
+				fresh = true
 			}
 			var e error
 			p, e = p.Move(&m.Move)
@@ -104,6 +128,11 @@ func main() {
 					ptn.FormatMove(&m.Move), e)
 			}
 		}
+		if *annotate != "" {
+			if e := ioutil.WriteFile(*annotate, []byte(out.Render()), 0644); e != nil {
+				log.Fatal("annotate:", e)
+			}
+		}
 	}
 }
 
@@ -117,6 +146,8 @@ func makeAI(p *tak.Position) *ai.MinimaxAI {
 		NoSort:     !*sort,
 		NoTable:    !*table,
 		NoNullMove: !*nullMove,
+		Threads:    *threads,
+		TableMB:    *tableMB,
 	})
 }
 
@@ -124,10 +155,11 @@ func analyze(p *tak.Position) {
 	analyzeWith(makeAI(p), p)
 }
 
-func analyzeWith(player *ai.MinimaxAI, p *tak.Position) {
+func analyzeWith(player *ai.MinimaxAI, p *tak.Position) *ptn.Eval {
 	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(*timeLimit))
 	defer cancel()
-	pv, val, _ := player.Analyze(ctx, p)
+	pv, val, st := player.Analyze(ctx, p)
+	ev := &ptn.Eval{Value: val, Depth: st.Depth, PV: pv}
 	if !*quiet {
 		cli.RenderBoard(os.Stdout, p)
 		if *explain {
@@ -146,7 +178,7 @@ func analyzeWith(player *ai.MinimaxAI, p *tak.Position) {
 	}
 	if *all {
 		fmt.Printf(" all moves:")
-		for _, m := range p.AllMoves(nil) {
+		for _, m := range p.LegalMoves(nil) {
 			fmt.Printf(" %s", ptn.FormatMove(&m))
 		}
 		fmt.Printf("\n")
@@ -160,7 +192,7 @@ func analyzeWith(player *ai.MinimaxAI, p *tak.Position) {
 			if val < ai.WinThreshold && val > -ai.WinThreshold {
 				log.Fatal("illegal move in non-terminal pv!")
 			}
-			return
+			return ev
 		}
 		p = n
 	}
@@ -174,4 +206,5 @@ func analyzeWith(player *ai.MinimaxAI, p *tak.Position) {
 		fmt.Println()
 		fmt.Println()
 	}
+	return ev
 }
@@ -18,6 +18,10 @@ import (
 
 var (
 	size    = flag.Int("size", 5, "board size")
+	komi    = flag.String("komi", "0", "komi for black, in flats (e.g. 2 or 2.5)")
+	pieces  = flag.Int("pieces", -1, "stones per side (default: standard for size)")
+	caps    = flag.Int("caps", -1, "capstones per side (default: standard for size)")
+	noFlat  = flag.Bool("no-flatten", false, "forbid capstones from flattening walls")
 	zero    = flag.Bool("zero", false, "start with zero weights, not defaults")
 	w1      = flag.String("w1", "", "first set of weights")
 	w2      = flag.String("w2", "", "second set of weights")
@@ -26,7 +30,7 @@ var (
 	perturb = flag.Float64("perturb", 0.0, "perturb weights")
 	seed    = flag.Int64("seed", 1, "starting random seed")
 	games   = flag.Int("games", 10, "number of games to play")
-	cutoff  = flag.Int("cutoff", 80, "cut games off after how many plies")
+	cutoff  = flag.Int("cutoff", 80, "draw games after how many plies")
 	swap    = flag.Bool("swap", true, "swap colors each game")
 
 	prefix = flag.String("prefix", "", "ptn file to start games at the end of")
@@ -36,7 +40,8 @@ var (
 
 	threads = flag.Int("threads", 4, "number of parallel threads")
 
-	out = flag.String("out", "", "directory to write ptns to")
+	out     = flag.String("out", "", "directory to write ptns to")
+	archive = flag.String("archive", "", "write all games to a single PTN file instead")
 
 	search = flag.Bool("search", false, "search for a good set of weights")
 
@@ -57,6 +62,15 @@ func main() {
 		}()
 	}
 
+	halfKomi, err := ptn.ParseKomi(*komi)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rules := gameRules(halfKomi)
+	if e := rules.Validate(); e != nil {
+		log.Fatal(e)
+	}
+
 	var p *tak.Position
 	if *prefix != "" {
 		bs, e := ioutil.ReadFile(*prefix)
@@ -67,6 +81,13 @@ func main() {
 		if e != nil {
 			log.Fatalf("Parse PTN: %v", e)
 		}
+		if sz, e := pt.Size(); e != nil || sz != *size {
+			log.Fatalf("%s: size %s does not match -size=%d",
+				*prefix, pt.FindTag("Size"), *size)
+		}
+		// replay the prefix under the rules from the flags,
+		// not those in its tags
+		pt.SetConfig(rules)
 		p, e = pt.PositionAtMove(0, tak.NoColor)
 		if e != nil {
 			log.Fatalf("PTN: %v", e)
@@ -110,7 +131,7 @@ func main() {
 	}
 
 	if *search {
-		doSearch(cfg1, weights1)
+		doSearch(cfg1, weights1, rules)
 		return
 	}
 
@@ -127,9 +148,14 @@ func main() {
 		Limit:   *limit,
 		Perturb: *perturb,
 		Initial: p,
+		Rules:   rules,
 	})
 
-	if *out != "" {
+	if *archive != "" {
+		if e := writeArchive(*archive, st.Games); e != nil {
+			log.Fatalf("archive: %v", e)
+		}
+	} else if *out != "" {
 		for _, r := range st.Games {
 			writeGame(*out, &r)
 		}
@@ -146,8 +172,8 @@ func main() {
 	if *c2 != "" {
 		log.Printf("p2c=%s", *c2)
 	}
-	log.Printf("done games=%d seed=%d ties=%d cutoff=%d white=%d black=%d",
-		*games, *seed, st.Ties, st.Cutoff, st.White, st.Black)
+	log.Printf("done games=%d seed=%d ties=%d cutoff=%d repetition=%d white=%d black=%d aborted=%d",
+		*games, *seed, st.Ties, st.Cutoff, st.Repetition, st.White, st.Black, st.Aborted)
 	log.Printf("p1.wins=%d (%d road/%d flat) p2.wins=%d (%d road/%d flat)",
 		st.Players[0].Wins, st.Players[0].RoadWins, st.Players[0].FlatWins,
 		st.Players[1].Wins, st.Players[1].RoadWins, st.Players[1].FlatWins)
@@ -158,19 +184,49 @@ func main() {
 	log.Printf("p[one-sided]=%f", binomTest(a, b, 0.5))
 }
 
+// gameRules returns the rules selected by the command-line flags.
+func gameRules(halfKomi int) tak.Config {
+	cfg := tak.Config{
+		Size:              *size,
+		HalfKomi:          halfKomi,
+		NoCapstoneFlatten: *noFlat,
+	}
+	if *pieces >= 0 || *caps >= 0 {
+		cfg.Reserves = tak.ReservesFor(*size, *pieces, *caps)
+	}
+	return cfg
+}
+
 func writeGame(d string, r *Result) {
 	os.MkdirAll(d, 0755)
-	p := &ptn.PTN{}
-	p.Tags = []ptn.Tag{
-		{"Size", fmt.Sprintf("%d", r.Position.Size())},
-		{"Player1", r.spec.p1color.String()},
+	ptnPath := path.Join(d, fmt.Sprintf("%d.ptn", r.spec.i))
+	ioutil.WriteFile(ptnPath, []byte(gamePTN(r).Render()), 0644)
+}
+
+func writeArchive(file string, rs []Result) error {
+	f, e := os.Create(file)
+	if e != nil {
+		return e
+	}
+	w := ptn.NewWriter(f)
+	for i := range rs {
+		if e := w.Write(gamePTN(&rs[i])); e != nil {
+			f.Close()
+			return e
+		}
 	}
+	return f.Close()
+}
+
+func gamePTN(r *Result) *ptn.PTN {
+	p := &ptn.PTN{}
+	p.SetConfig(r.Position.Config())
+	p.SetPlayer(tak.White, r.spec.p1color.String())
 	for i, m := range r.Moves {
 		if i%2 == 0 {
 			p.Ops = append(p.Ops, &ptn.MoveNumber{Number: i/2 + 1})
 		}
 		p.Ops = append(p.Ops, &ptn.Move{Move: m})
 	}
-	ptnPath := path.Join(d, fmt.Sprintf("%d.ptn", r.spec.i))
-	ioutil.WriteFile(ptnPath, []byte(p.Render()), 0644)
+	return p
 }
@@ -10,6 +10,7 @@ import (
 	"golang.org/x/net/context"
 
 	"../../ai"
+	"../../ptn"
 	"../../tak"
 )
 
@@ -18,7 +19,11 @@ type Config struct {
 
 	Verbose bool
 
+	// Initial, if set, is the position games start from, which
+	// must have been set up under Rules
 	Initial *tak.Position
+	// Rules are the rules games are played under
+	Rules tak.Config
 
 	Cfg1, Cfg2 ai.MinimaxConfig
 	W1, W2     ai.Weights
@@ -26,6 +31,7 @@ type Config struct {
 	Swap    bool
 	Threads int
 	Seed    int64
+	// Cutoff is the ply limit after which games are drawn
 	Cutoff  int
 	Limit   time.Duration
 	Perturb float64
@@ -38,8 +44,14 @@ type Stats struct {
 		RoadWins int
 	}
 	White, Black int
-	Ties         int
-	Cutoff       int
+	// Ties counts all drawn games, including those drawn by the
+	// ply limit (Cutoff) or by repetition (Repetition).
+	Ties       int
+	Cutoff     int
+	Repetition int
+	// Aborted counts games stopped by an illegal move, which are
+	// in none of the totals above.
+	Aborted int
 
 	Games []Result
 }
@@ -55,6 +67,7 @@ type Result struct {
 	spec     gameSpec
 	Position *tak.Position
 	Moves    []tak.Move
+	Details  tak.WinDetails
 }
 
 func Simulate(c *Config) Stats {
@@ -62,7 +75,7 @@ func Simulate(c *Config) Stats {
 	rc := make(chan Result)
 	go startGames(c, rc)
 	for r := range rc {
-		d := r.Position.WinDetails()
+		d := r.Details
 		if c.Verbose {
 			log.Printf("game n=%d plies=%d p1=%s winner=%s wf=%d bf=%d ws=%d bs=%d",
 				r.spec.i, r.Position.MoveNumber(),
@@ -81,8 +94,14 @@ func Simulate(c *Config) Stats {
 			} else {
 				st.Ties++
 			}
+			switch d.Reason {
+			case tak.PlyLimitDraw:
+				st.Cutoff++
+			case tak.RepetitionDraw:
+				st.Repetition++
+			}
 		} else {
-			st.Cutoff++
+			st.Aborted++
 		}
 		if d.Over && d.Winner != tak.NoColor {
 			pst := &st.Players[0]
@@ -157,12 +176,16 @@ func worker(games <-chan gameSpec, out chan<- Result) {
 	for g := range games {
 		white := ai.NewMinimax(*g.white)
 		black := ai.NewMinimax(*g.black)
-		var ms []tak.Move
 		p := g.c.Initial
 		if p == nil {
-			p = tak.New(tak.Config{Size: g.c.Cfg1.Size})
+			p = tak.New(g.c.Rules)
 		}
-		for i := 0; i < g.c.Cutoff; i++ {
+		game := tak.NewGame(p)
+		game.MaxPlies = g.c.Cutoff
+		for {
+			if ok, _ := game.GameOver(); ok {
+				break
+			}
 			var m tak.Move
 			var cancel context.CancelFunc
 			ctx := context.Background()
@@ -177,16 +200,19 @@ func worker(games <-chan gameSpec, out chan<- Result) {
 			if cancel != nil {
 				cancel()
 			}
-			p, _ = p.Move(&m)
-			ms = append(ms, m)
-			if ok, _ := p.GameOver(); ok {
+			next, e := game.Move(&m)
+			if e != nil {
+				log.Printf("game n=%d: illegal move %s: %v",
+					g.i, ptn.FormatMove(&m), e)
 				break
 			}
+			p = next
 		}
 		out <- Result{
 			spec:     g,
-			Position: p,
-			Moves:    ms,
+			Position: game.Position(),
+			Moves:    game.Moves,
+			Details:  game.WinDetails(),
 		}
 	}
 }
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"../../ptn"
+	"../../tak"
+)
+
+var (
+	size   = flag.Int("size", 5, "board size, if -tps is not given")
+	tps    = flag.String("tps", "", "position to count from, in TPS")
+	depth  = flag.Int("depth", 3, "depth to count to")
+	divide = flag.Bool("divide", false, "print the count below each root move")
+)
+
+func main() {
+	flag.Parse()
+
+	var p *tak.Position
+	if *tps != "" {
+		var e error
+		p, e = ptn.ParseTPS(*tps)
+		if e != nil {
+			log.Fatal("tps:", e)
+		}
+	} else {
+		cfg := tak.Config{Size: *size}
+		if e := cfg.Validate(); e != nil {
+			log.Fatal(e)
+		}
+		p = tak.New(cfg)
+	}
+
+	start := time.Now()
+	var nodes uint64
+	if *divide {
+		for _, e := range tak.PerftDivide(p, *depth) {
+			fmt.Printf("%s: %d\n", ptn.FormatMove(&e.Move), e.Nodes)
+			nodes += e.Nodes
+		}
+	} else {
+		nodes = tak.Perft(p, *depth)
+	}
+	elapsed := time.Since(start)
+	fmt.Printf("perft(%d)=%d time=%s", *depth, nodes, elapsed)
+	if elapsed > 0 {
+		fmt.Printf(" nps=%.0f", float64(nodes)/elapsed.Seconds())
+	}
+	fmt.Printf("\n")
+}
@@ -17,7 +17,7 @@ import (
 	"../../ai"
 	"../../ai/mcts"
 	"../../cli"
-	//"../../ptn"
+	"../../ptn"
 	"../../tak"
 )
 
@@ -25,6 +25,10 @@ var (
 	white = flag.String("white", "human", "white player")
 	black = flag.String("black", "nohat", "white player")
 	size  = flag.Int("size", 5, "game size")
+	komi  = flag.String("komi", "0", "komi for black, in flats (e.g. 2 or 2.5)")
+	pieces = flag.Int("pieces", -1, "flat stones per player (-1 for the size default)")
+	caps   = flag.Int("caps", -1, "capstones per player (-1 for the size default)")
+	noFlat = flag.Bool("no-flatten", false, "capstones may not flatten standing stones")
 	debug = flag.Int("debug", 0, "debug level")
 	limit = flag.Duration("limit", time.Minute, "ai time limit")
 	out   = flag.String("out", "", "write ptn to file")
@@ -298,6 +302,19 @@ func main(){
 
 func main() {
 	flag.Parse()
+	halfKomi, err := ptn.ParseKomi(*komi)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg := tak.Config{
+		Size:              *size,
+		HalfKomi:          halfKomi,
+		Reserves:          tak.ReservesFor(*size, *pieces, *caps),
+		NoCapstoneFlatten: *noFlat,
+	}
+	if e := cfg.Validate(); e != nil {
+		log.Fatal(e)
+	}
 	in := bufio.NewReader(os.Stdin)
 	limit := *repeat
 	result := ""
@@ -307,13 +324,14 @@ func main() {
 		winsB := 0
 		for a:=0; a<limit; a++ {
 			st := &cli.CLI{
-				Config: tak.Config{Size: *size},
+				Config: cfg,
 				Out:    os.Stdout, //ioutil.Discard, //
 				White:  parsePlayer(in, *white),
 				Black:  parsePlayer(in, *black),
 				Silent: *silent,
 			}
 			final := st.Play()
+			d := st.Game().WinDetails()
 			/*if *out != "" {
 				p := &ptn.PTN{}
 				p.Tags = []ptn.Tag{
@@ -325,12 +343,12 @@ func main() {
 				ioutil.WriteFile(*out, []byte(p.Render()), 0644)
 			}*/
 			fmt.Printf("%d.%d\n",b,a)
-			fmt.Printf("%+v\n\n", final.WinDetails().Winner)
+			fmt.Printf("%+v\n\n", d.Winner)
 			fmt.Printf("%+v\n\n", final.GetHash())
-			if final.WinDetails().Winner == tak.White {
+			if d.Winner == tak.White {
 				winsA++
 			}
-			if final.WinDetails().Winner == tak.Black {
+			if d.Winner == tak.Black {
 				winsB++
 			}
 		}
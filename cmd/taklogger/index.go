@@ -3,16 +3,16 @@ package main
 import (
 	"database/sql"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
-	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 
 	"../../ptn"
+	"../../tak"
 )
 
 const createGameTable = `
@@ -83,20 +83,27 @@ func indexPTN(dir string, db string) error {
 	}
 	defer stmt.Close()
 	for _, g := range ptns {
-		day := g.FindTag("Date")
-		id, e := strconv.Atoi(g.FindTag("Id"))
-		if day == "" || e != nil {
+		date, e := g.Date()
+		if e != nil {
+			continue
+		}
+		day := date.Format("2006-01-02")
+		id, e := g.Id()
+		if e != nil || id == 0 {
 			continue
 		}
-		size, _ := strconv.Atoi(g.FindTag("Size"))
-		t, _ := time.Parse(g.FindTag("Time"), time.RFC3339)
-		player1 := g.FindTag("Player1")
-		player2 := g.FindTag("Player2")
-		result := g.FindTag("Result")
-		winner := (&ptn.Result{Result: result}).Winner().String()
+		size, _ := g.Size()
+		t, _ := g.Time()
+		result := ""
+		winner := tak.NoColor.String()
+		if r, _ := g.Result(); r != nil {
+			result = r.Result
+			winner = r.Winner().String()
+		}
 		moves := countMoves(g)
 		_, e = stmt.Exec(
-			day, id, t, size, player1, player2, result, winner, moves,
+			day, id, t, size, g.Player(tak.White), g.Player(tak.Black),
+			result, winner, moves,
 		)
 		if e != nil {
 			return e
@@ -136,13 +143,21 @@ func readPTNs(d string) ([]*ptn.PTN, error) {
 			return nil
 		}
 		defer f.Close()
-		g, e := ptn.ParsePTN(f)
-		if e != nil {
-			log.Printf("parse(%s): %v", path, e)
-			return nil
+		r := ptn.NewReader(f)
+		for {
+			g, e := r.Next()
+			if e == io.EOF {
+				return nil
+			}
+			if e != nil {
+				log.Printf("parse(%s): %v", path, e)
+				if _, ok := e.(*ptn.GameError); ok {
+					continue
+				}
+				return nil
+			}
+			out = append(out, g)
 		}
-		out = append(out, g)
-		return nil
 	})
 	return out, e
 }
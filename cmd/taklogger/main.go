@@ -20,6 +20,7 @@ import (
 var (
 	server     = flag.String("server", "playtak.com:10000", "playtak.com server to connect to")
 	out        = flag.String("out", "ptn", "Directory to write PTN files")
+	archive    = flag.String("archive", "", "append games to a single PTN file instead")
 	index      = flag.String("index", "", "write a sqlite index")
 	cpuProfile = flag.String("cpu-profile", "", "write a CPU profile")
 )
@@ -79,6 +80,15 @@ func logGames(client *playtak.Client, out string) error {
 	if e != nil {
 		return e
 	}
+	var w *ptn.Writer
+	if *archive != "" {
+		f, e := os.OpenFile(*archive, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if e != nil {
+			return e
+		}
+		defer f.Close()
+		w = ptn.NewWriter(f)
+	}
 	games := make(map[string]*Game)
 	for line := range client.Recv() {
 		if strings.HasPrefix(line, "GameList Add") {
@@ -93,7 +103,7 @@ func logGames(client *playtak.Client, out string) error {
 		no := strings.SplitN(words[0], "#", 2)[1]
 		if g, ok := games[no]; ok {
 			if over := handleCmd(g, words); over {
-				render(g, out)
+				render(g, out, w)
 				delete(games, no)
 			}
 		}
@@ -120,7 +130,7 @@ func addGame(games map[string]*Game, line string) *Game {
 func handleCmd(g *Game, cmd []string) bool {
 	switch cmd[1] {
 	case "P", "M":
-		m, e := playtak.ParseServer(strings.Join(cmd[1:], " "))
+		m, e := playtak.ParseServerSize(strings.Join(cmd[1:], " "), g.Size)
 		if e != nil {
 			log.Printf("bad move: %v", cmd)
 			return true
@@ -137,24 +147,28 @@ func handleCmd(g *Game, cmd []string) bool {
 	return false
 }
 
-func render(g *Game, dir string) {
+// render writes `g` to `archive`, or if it is nil to its own file
+// under `dir`.
+func render(g *Game, dir string, archive *ptn.Writer) {
 	p := ptn.PTN{}
-	p.Tags = []ptn.Tag{
-		{Name: "Size", Value: strconv.Itoa(g.Size)},
-		{Name: "Date", Value: g.Date},
-		{Name: "Time", Value: g.Time.UTC().Format(time.RFC3339)},
-		{Name: "Player1", Value: g.White},
-		{Name: "Player2", Value: g.Black},
-		{Name: "Result", Value: g.Result},
-		{Name: "Id", Value: g.Id},
+	p.SetConfig(tak.Config{Size: g.Size})
+	p.SetTime(g.Time)
+	p.SetPlayer(tak.White, g.White)
+	p.SetPlayer(tak.Black, g.Black)
+	p.SetResult(g.Result)
+	if id, e := strconv.Atoi(g.Id); e == nil {
+		p.SetId(id)
 	}
-	for i, m := range g.Moves {
-		if i%2 == 0 {
-			p.Ops = append(p.Ops, &ptn.MoveNumber{Number: i/2 + 1})
+	// we know neither the komi nor the reserves, so the result is
+	// the server's rather than what the board seems to say
+	p.AddMoves(g.Moves, ptn.MarkMoves, ptn.NoResults)
+	p.Ops = append(p.Ops, &ptn.Result{Result: g.Result})
+	if archive != nil {
+		if e := archive.Write(&p); e != nil {
+			log.Printf("write game: %v", e)
 		}
-		p.Ops = append(p.Ops, &ptn.Move{Move: m})
+		return
 	}
-	p.Ops = append(p.Ops, &ptn.Result{Result: g.Result})
 	out := p.Render()
 	dir = path.Join(dir, g.Date)
 	if e := os.MkdirAll(dir, 0755); e != nil {
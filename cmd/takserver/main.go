@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"../../playtak/server"
+)
+
+var (
+	listen = flag.String("listen", "localhost:10000", "address to listen on")
+	users  = flag.String("users", "", "file of `user password` lines; if unset, any login is accepted")
+	debug  = flag.Bool("debug", false, "log every line sent and received")
+)
+
+func main() {
+	flag.Parse()
+	s := &server.Server{Debug: *debug}
+	if *users != "" {
+		pw, e := readPasswords(*users)
+		if e != nil {
+			log.Fatal("users: ", e)
+		}
+		s.Passwords = pw
+	}
+	log.Printf("listening on %s", *listen)
+	log.Fatal(s.ListenAndServe(*listen))
+}
+
+func readPasswords(path string) (map[string]string, error) {
+	f, e := os.Open(path)
+	if e != nil {
+		return nil, e
+	}
+	defer f.Close()
+	pw := make(map[string]string)
+	r := bufio.NewScanner(f)
+	for r.Scan() {
+		words := strings.Fields(r.Text())
+		if len(words) == 2 {
+			pw[words[0]] = words[1]
+		}
+	}
+	return pw, r.Err()
+}
@@ -8,6 +8,7 @@ import (
 	"reflect"
 
 	"../../ai"
+	"../../tak"
 )
 
 type field struct {
@@ -43,7 +44,7 @@ func getFields(w *ai.Weights) []field {
 
 const Stride = 100
 
-func doSearch(cfg ai.MinimaxConfig, w ai.Weights) {
+func doSearch(cfg ai.MinimaxConfig, w ai.Weights, rules tak.Config) {
 	fields := getFields(&w)
 	r := rand.New(rand.NewSource(*seed))
 	for {
@@ -64,6 +65,7 @@ func doSearch(cfg ai.MinimaxConfig, w ai.Weights) {
 			Threads: *threads,
 			Cutoff:  *cutoff,
 			Limit:   *limit,
+			Rules:   rules,
 		})
 
 		log.Printf("done ties=%d p1.wins=%d (%d road/%d flat) p2.wins=%d (%d road/%d flat)",
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"../../ai"
+	"../../tak"
+)
+
+func TestSimulate(t *testing.T) {
+	cfg := ai.MinimaxConfig{Size: 4, Depth: 2}
+	c := &Config{
+		Games:   4,
+		Rules:   tak.Config{Size: 4},
+		Cfg1:    cfg,
+		Cfg2:    cfg,
+		W1:      ai.DefaultWeights[4],
+		W2:      ai.DefaultWeights[4],
+		Swap:    true,
+		Threads: 2,
+		Seed:    1,
+		Cutoff:  30,
+	}
+	st := Simulate(c)
+	if len(st.Games) != c.Games {
+		t.Fatalf("games=%d want %d", len(st.Games), c.Games)
+	}
+	if st.Aborted != 0 {
+		t.Errorf("aborted=%d", st.Aborted)
+	}
+	if n := st.White + st.Black + st.Ties; n != c.Games {
+		t.Errorf("white+black+ties=%d want %d", n, c.Games)
+	}
+	if n := st.Players[0].Wins + st.Players[1].Wins; n != st.White+st.Black {
+		t.Errorf("player wins=%d want %d", n, st.White+st.Black)
+	}
+	for _, r := range st.Games {
+		plies := len(r.Moves)
+		if plies != r.Position.MoveNumber() {
+			t.Errorf("game %d: moves=%d ply=%d", r.spec.i, plies, r.Position.MoveNumber())
+		}
+		if plies < 2 || plies > c.Cutoff {
+			t.Errorf("game %d: plies=%d", r.spec.i, plies)
+		}
+		if !r.Details.Over {
+			t.Errorf("game %d: not over", r.spec.i)
+		}
+	}
+}
@@ -101,7 +101,7 @@ func (f *Friendly) waitUndo(p *tak.Position) bool {
 	if v < ai.WinThreshold || st.Depth > 1 {
 		return false
 	}
-	_, v, st = f.check.Analyze(ctx, f.g.Positions[len(f.g.Positions)-2])
+	_, v, st = f.check.Analyze(ctx, f.g.History.Positions[len(f.g.History.Positions)-2])
 	if v > -ai.WinThreshold {
 		return true
 	}
@@ -169,6 +169,7 @@ func (f *Friendly) Config() ai.MinimaxConfig {
 
 		NoSort:  !*sort,
 		NoTable: !*table,
+		TableMB: *tableMB,
 	}
 	cfg.Depth, cfg.Evaluate = f.levelSettings(f.g.Size, f.level)
 
@@ -32,6 +32,7 @@ var (
 	limit           = flag.Duration("limit", time.Minute, "time limit per move")
 	sort            = flag.Bool("sort", false, "sort moves via history heuristic")
 	table           = flag.Bool("table", false, "use the transposition table")
+	tableMB         = flag.Int("table-mb", 0, "transposition table size in megabytes (0 for the default)")
 	useOpponentTime = flag.Bool("use-opponent-time", false, "think on opponent's time")
 
 	debugClient = flag.Bool("debug-client", false, "log debug output for playtak connection")
@@ -1,7 +1,7 @@
 package main
 
 import (
-	//"log"
+	"log"
 	//"strconv"
 	"time"
 
@@ -21,6 +21,20 @@ type Taktician struct {
 	client *playtak.Client
 	ai     *ai.MinimaxAI
 	aifast *ai.MinimaxAI
+
+	// pv is the principal variation of our last search, whose
+	// second move is the reply we ponder on.
+	pv     []tak.Move
+	ponder *ponderSearch
+}
+
+// A ponderSearch is a search of the position after the reply we
+// expect, started on our opponent's time.
+type ponderSearch struct {
+	p      *tak.Position
+	cancel context.CancelFunc
+	done   chan struct{}
+	pv     []tak.Move
 }
 
 func (t *Taktician) NewGame(g *bot.Game) {
@@ -34,6 +48,7 @@ func (t *Taktician) NewGame(g *bot.Game) {
 		Evaluate: ai.MakeNohat(g.Size, nil),
 		NoSort:  !*sort,
 		NoTable: !*table,
+		TableMB: *tableMB,
 	})
 	t.ai.Diversify=200
 	t.aifast = ai.NewMinimax(ai.MinimaxConfig{
@@ -43,6 +58,7 @@ func (t *Taktician) NewGame(g *bot.Game) {
 		Evaluate: ai.MakeNohat(g.Size, nil),
 		NoSort:  !*sort,
 		NoTable: !*table,
+		TableMB: *tableMB,
 	})
 }
 
@@ -87,9 +103,28 @@ func (t *Taktician) GetMove(
 	defer cancel()
 	var m tak.Move
 	if t.g.MyTime()<40*time.Second || p.MoveNumber()<=4 {
+		t.stopPonder()
+		t.pv = nil
 		m = t.aifast.GetMove(ctx, p)
-	} else {
+	} else if *depth == 1 {
+		t.stopPonder()
+		t.pv = nil
 		m = t.ai.GetMove(ctx, p)
+	} else {
+		// on a ponder hit, this search picks up where the ponder
+		// search left off in the transposition table, under the
+		// same deadline as any other
+		ponder := t.ponderHit(p)
+		t.pv, _, _ = t.ai.Analyze(ctx, p)
+		if len(t.pv) == 0 {
+			t.pv = ponder
+		}
+		if len(t.pv) > 0 {
+			m = t.pv[0]
+		} else {
+			// the search was cut off before it found any move
+			m = t.aifast.GetMove(ctx, p)
+		}
 	}
 	select {
 	case <-deadline:
@@ -99,7 +134,61 @@ func (t *Taktician) GetMove(
 	return m
 }
 
+// Ponder searches the position after the reply to our last move
+// that our search predicted, while the opponent thinks. The search
+// outlives `ctx`, until GetMove stops it: if the opponent played the
+// predicted move, GetMove's own search starts from the ponder
+// search's entries in the transposition table.
+func (t *Taktician) Ponder(ctx context.Context, p *tak.Position) {
+	t.stopPonder()
+	if !*useOpponentTime || len(t.pv) < 2 || t.ai == nil {
+		return
+	}
+	next, e := p.Move(&t.pv[1])
+	if e != nil {
+		return
+	}
+	if over, _ := next.GameOver(); over {
+		return
+	}
+	pctx, cancel := context.WithCancel(context.Background())
+	ps := &ponderSearch{p: next, cancel: cancel, done: make(chan struct{})}
+	t.ponder = ps
+	go func(a *ai.MinimaxAI) {
+		defer close(ps.done)
+		ps.pv, _, _ = a.Analyze(pctx, next)
+	}(t.ai)
+	<-ctx.Done()
+}
+
+// ponderHit stops any ponder search, and returns the principal
+// variation it had found if it was searching `p`.
+func (t *Taktician) ponderHit(p *tak.Position) []tak.Move {
+	ps := t.ponder
+	if ps == nil {
+		return nil
+	}
+	t.stopPonder()
+	if ps.p.Hash() != p.Hash() || ps.p.MoveNumber() != p.MoveNumber() {
+		log.Printf("ponder-miss game-id=%s ply=%d", t.g.ID, p.MoveNumber())
+		return nil
+	}
+	log.Printf("ponder-hit game-id=%s ply=%d", t.g.ID, p.MoveNumber())
+	return ps.pv
+}
+
+func (t *Taktician) stopPonder() {
+	if t.ponder == nil {
+		return
+	}
+	t.ponder.cancel()
+	<-t.ponder.done
+	t.ponder = nil
+}
+
 func (t *Taktician) GameOver() {
+	t.stopPonder()
+	t.pv = nil
 	t.ai = nil
 }
 
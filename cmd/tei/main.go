@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"../../ai"
+	"../../ptn"
+	"../../tak"
+)
+
+var (
+	size    = flag.Int("size", 5, "board size until the GUI sends teinewgame")
+	debug   = flag.Int("debug", 0, "debug level")
+	depth   = flag.Int("depth", 0, "maximum search depth (0 for no limit)")
+	threads = flag.Int("threads", 1, "number of parallel search threads")
+	tableMB = flag.Int("table-mb", 0, "transposition table size in megabytes (0 for the default)")
+	limit   = flag.Duration("limit", time.Minute, "longest time to spend on a move")
+)
+
+const engineName = "Nohat AI"
+
+// An engine holds the state of one TEI session: the position the GUI
+// last set up and the search, if any, that is running on it.
+type engine struct {
+	out io.Writer
+	mu  sync.Mutex
+
+	halfKomi int
+	size     int
+	ai       *ai.MinimaxAI
+	pos      *tak.Position
+
+	// cancel stops the running search, and done is closed when it
+	// has written its bestmove.
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func main() {
+	flag.Parse()
+	if *size < 3 || *size > 8 {
+		log.Fatalf("bad size: %d", *size)
+	}
+	e := &engine{out: os.Stdout}
+	e.newGame(*size)
+	in := bufio.NewScanner(os.Stdin)
+	for in.Scan() {
+		if !e.handle(strings.Fields(in.Text())) {
+			break
+		}
+	}
+	e.stop()
+}
+
+func (e *engine) send(format string, args ...interface{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fmt.Fprintf(e.out, format+"\n", args...)
+}
+
+// handle runs one command from the GUI, and returns false on `quit`.
+func (e *engine) handle(words []string) bool {
+	if len(words) == 0 {
+		return true
+	}
+	switch words[0] {
+	case "tei":
+		e.send("id name %s", engineName)
+		e.send("option name HalfKomi type spin default 0 min 0 max 10")
+		e.send("teiok")
+	case "isready":
+		e.send("readyok")
+	case "setoption":
+		e.setOption(words[1:])
+	case "teinewgame":
+		e.stop()
+		sz := e.size
+		if len(words) > 1 {
+			n, err := strconv.Atoi(words[1])
+			if err != nil || n < 3 || n > 8 {
+				log.Printf("teinewgame: bad size: %s", words[1])
+				return true
+			}
+			sz = n
+		}
+		e.newGame(sz)
+	case "position":
+		e.stop()
+		if err := e.position(words[1:]); err != nil {
+			log.Printf("position: %v", err)
+		}
+	case "go":
+		e.stop()
+		if err := e.search(words[1:]); err != nil {
+			log.Printf("go: %v", err)
+		}
+	case "stop":
+		e.stop()
+	case "quit":
+		return false
+	default:
+		log.Printf("unknown command: %s", words[0])
+	}
+	return true
+}
+
+func (e *engine) config() tak.Config {
+	return tak.Config{Size: e.size, HalfKomi: e.halfKomi}
+}
+
+func (e *engine) newGame(size int) {
+	e.size = size
+	e.pos = tak.New(e.config())
+	e.ai = ai.NewMinimax(ai.MinimaxConfig{
+		Size:     size,
+		Depth:    *depth,
+		Debug:    *debug,
+		Threads:  *threads,
+		TableMB:  *tableMB,
+		Progress: e.info,
+	})
+}
+
+// setOption handles `setoption name <name> value <value>`.
+func (e *engine) setOption(words []string) {
+	if len(words) != 4 || words[0] != "name" || words[2] != "value" {
+		log.Printf("setoption: bad syntax: %s", strings.Join(words, " "))
+		return
+	}
+	switch words[1] {
+	case "HalfKomi":
+		n, err := strconv.Atoi(words[3])
+		if err != nil || n < 0 || n > 10 {
+			log.Printf("setoption: bad HalfKomi: %s", words[3])
+			return
+		}
+		e.halfKomi = n
+	default:
+		log.Printf("setoption: unknown option: %s", words[1])
+	}
+}
+
+// position handles `position startpos [moves ...]` and
+// `position tps <tps> [moves ...]`, where the TPS takes three words.
+func (e *engine) position(words []string) error {
+	var p *tak.Position
+	switch {
+	case len(words) >= 1 && words[0] == "startpos":
+		p = tak.New(e.config())
+		words = words[1:]
+	case len(words) >= 4 && words[0] == "tps":
+		var err error
+		p, err = ptn.ParseTPSConfig(strings.Join(words[1:4], " "), e.config())
+		if err != nil {
+			return err
+		}
+		words = words[4:]
+	default:
+		return fmt.Errorf("bad syntax: %s", strings.Join(words, " "))
+	}
+	if p.Size() != e.size {
+		return fmt.Errorf("size %d does not match game size %d", p.Size(), e.size)
+	}
+	if len(words) > 0 {
+		if words[0] != "moves" {
+			return fmt.Errorf("expected moves: %s", words[0])
+		}
+		for _, w := range words[1:] {
+			m, err := ptn.ParseMove(w)
+			if err != nil {
+				return err
+			}
+			if p, err = p.Move(&m); err != nil {
+				return fmt.Errorf("illegal move %s: %v", w, err)
+			}
+		}
+	}
+	e.pos = p
+	return nil
+}
+
+// search handles `go`, starting a search that writes its bestmove
+// when it finishes or is stopped.
+func (e *engine) search(words []string) error {
+	var movetime, left, inc time.Duration
+	infinite := false
+	searcher := e.ai
+	for len(words) > 0 {
+		if words[0] == "infinite" {
+			infinite = true
+			words = words[1:]
+			continue
+		}
+		if len(words) < 2 {
+			return fmt.Errorf("missing value for %s", words[0])
+		}
+		n, err := strconv.Atoi(words[1])
+		if err != nil {
+			return fmt.Errorf("bad %s: %s", words[0], words[1])
+		}
+		ms := time.Duration(n) * time.Millisecond
+		white := e.pos.ToMove() == tak.White
+		switch words[0] {
+		case "movetime":
+			movetime = ms
+		case "wtime":
+			if white {
+				left = ms
+			}
+		case "btime":
+			if !white {
+				left = ms
+			}
+		case "winc":
+			if white {
+				inc = ms
+			}
+		case "binc":
+			if !white {
+				inc = ms
+			}
+		case "depth":
+			// a fresh AI takes the depth for this search only;
+			// the transposition table is lost, but a depth
+			// limited search is rarely one that needs it
+			searcher = ai.NewMinimax(ai.MinimaxConfig{
+				Size:     e.size,
+				Depth:    n,
+				Debug:    *debug,
+				Threads:  *threads,
+				TableMB:  *tableMB,
+				Progress: e.info,
+			})
+		default:
+			return fmt.Errorf("unknown parameter: %s", words[0])
+		}
+		words = words[2:]
+	}
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if infinite {
+		ctx, cancel = context.WithCancel(context.Background())
+	} else {
+		ctx, cancel = context.WithTimeout(context.Background(),
+			timeBound(movetime, left, inc))
+	}
+	e.cancel = cancel
+	e.done = make(chan struct{})
+	go func(p *tak.Position, done chan struct{}) {
+		defer close(done)
+		pv, _, _ := searcher.Analyze(ctx, p)
+		if len(pv) == 0 {
+			e.send("bestmove 0000")
+			return
+		}
+		e.send("bestmove %s", ptn.FormatMove(&pv[0]))
+	}(e.pos, e.done)
+	return nil
+}
+
+// timeBound picks how long to spend on a move: all of `movetime` if
+// the GUI gave one, else a slice of the time left on the clock,
+// capped by -limit.
+func timeBound(movetime, left, inc time.Duration) time.Duration {
+	if movetime > 0 {
+		return movetime
+	}
+	if left == 0 {
+		return *limit
+	}
+	budget := left/20 + inc/2
+	if budget > left/2 {
+		budget = left / 2
+	}
+	if budget > *limit {
+		budget = *limit
+	}
+	return budget
+}
+
+// stop cancels the running search, if any, and waits for its
+// bestmove.
+func (e *engine) stop() {
+	if e.cancel == nil {
+		return
+	}
+	e.cancel()
+	<-e.done
+	e.cancel, e.done = nil, nil
+}
+
+// info reports a completed depth of the search to the GUI.
+func (e *engine) info(depth int, value int64, pv []tak.Move, st ai.Stats) {
+	var moves []string
+	for i := range pv {
+		moves = append(moves, ptn.FormatMove(&pv[i]))
+	}
+	e.send("info depth %d score %s nodes %d hashfull %d pv %s",
+		depth, score(value, len(pv)), st.Visited+st.Evaluated, st.TTFill,
+		strings.Join(moves, " "))
+}
+
+// score renders `value` as a TEI score: `mate N`, in moves and
+// negative if we are the one losing, for a won or lost position with
+// a principal variation `plies` long, and `cp N` otherwise.
+func score(value int64, plies int) string {
+	switch {
+	case value > ai.WinThreshold:
+		return fmt.Sprintf("mate %d", (plies+1)/2)
+	case value < -ai.WinThreshold:
+		return fmt.Sprintf("mate %d", -(plies+1)/2)
+	}
+	return fmt.Sprintf("cp %d", value)
+}
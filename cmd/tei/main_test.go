@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"../../ai"
+)
+
+func run(t *testing.T, e *engine, cmds ...string) {
+	for _, cmd := range cmds {
+		if !e.handle(strings.Fields(cmd)) {
+			t.Fatalf("%q: engine quit", cmd)
+		}
+	}
+}
+
+func TestTEI(t *testing.T) {
+	var out bytes.Buffer
+	e := &engine{out: &out}
+	e.newGame(5)
+	run(t, e,
+		"tei",
+		"position tps 1,1,1,1,x/x5/x5/x5/2,2,2,x2 2 3 moves e2",
+		"go depth 3",
+		"stop",
+	)
+	if e.handle([]string{"quit"}) {
+		t.Fatal("quit: engine did not quit")
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) < 5 || lines[0] != "id name "+engineName || lines[2] != "teiok" {
+		t.Fatalf("bad handshake:\n%s", out.String())
+	}
+	if want := "option name HalfKomi type spin default 0 min 0 max 10"; lines[1] != want {
+		t.Errorf("option=%q want %q", lines[1], want)
+	}
+	info := lines[3]
+	if !strings.HasPrefix(info, "info depth 1 score mate 1 ") ||
+		!strings.HasSuffix(info, "e5") {
+		t.Errorf("info=%q", info)
+	}
+	// a flat and a capstone on e5 win alike
+	if last := lines[len(lines)-1]; last != "bestmove e5" && last != "bestmove Ce5" {
+		t.Errorf("last line=%q want bestmove e5", last)
+	}
+}
+
+func TestSetOption(t *testing.T) {
+	e := &engine{out: &bytes.Buffer{}}
+	e.newGame(5)
+	cases := []struct {
+		value string
+		half  int
+	}{
+		{"4", 4},
+		{"-2", 4},
+		{"11", 4},
+		{"x", 4},
+		{"0", 0},
+	}
+	for _, tc := range cases {
+		run(t, e, "setoption name HalfKomi value "+tc.value)
+		if e.halfKomi != tc.half {
+			t.Errorf("HalfKomi %s: got %d want %d", tc.value, e.halfKomi, tc.half)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	cases := []struct {
+		value int64
+		plies int
+		out   string
+	}{
+		{120, 3, "cp 120"},
+		{-120, 3, "cp -120"},
+		{ai.MaxEval - 20, 1, "mate 1"},
+		{ai.MaxEval - 20, 3, "mate 2"},
+		{ai.MinEval + 20, 4, "mate -2"},
+	}
+	for _, tc := range cases {
+		if got := score(tc.value, tc.plies); got != tc.out {
+			t.Errorf("score(%d, %d)=%q want %q", tc.value, tc.plies, got, tc.out)
+		}
+	}
+}
@@ -22,6 +22,11 @@ type Game struct {
 	Color    tak.Color
 	Size     int
 	Time     time.Duration
+	// HalfKomi is the komi in half-flats, as sent by the server
+	HalfKomi int
+	// Reserves are the pieces each side starts with, if the
+	// server specified them
+	Reserves *tak.Reserves
 
 	times struct {
 		mine, theirs time.Duration
@@ -32,8 +37,9 @@ type Game struct {
 	bot      Bot
 	moveLock sync.Mutex
 
-	Positions []*tak.Position
-	moves     []tak.Move
+	// History records the game so far. The server adjudicates the
+	// result, so its draw rules are disabled.
+	History *tak.Game
 }
 
 type Bot interface {
@@ -46,6 +52,17 @@ type Bot interface {
 	HandleChat(who, msg string)
 }
 
+// A Ponderer is a Bot that thinks on its opponent's time. While the
+// opponent is to move, PlayGame calls Ponder instead of GetMove,
+// cancelling `ctx` once the opponent has moved; GetMove for the
+// position that follows is not called until Ponder has returned.
+// Ponder may leave work running in the background for that GetMove
+// to pick up.
+type Ponderer interface {
+	Bot
+	Ponder(ctx context.Context, p *tak.Position)
+}
+
 type Client interface {
 	Recv() <-chan string
 	SendCommand(...string)
@@ -69,22 +86,44 @@ func parseGameStart(line string) *Game {
 
 	secs, _ := strconv.Atoi(bits[8])
 	g.Time = time.Duration(secs) * time.Second
+	if len(bits) > 9 {
+		g.HalfKomi, _ = strconv.Atoi(bits[9])
+	}
+	if len(bits) > 11 {
+		pieces, e1 := strconv.Atoi(bits[10])
+		caps, e2 := strconv.Atoi(bits[11])
+		if r := tak.ReservesFor(g.Size, pieces, caps); e1 == nil && e2 == nil && r.Valid() {
+			g.Reserves = r
+		}
+	}
 	return &g
 }
 
 func PlayGame(c Client, b Bot, line string) {
 	ctx := context.Background()
 	g := parseGameStart(line)
+	cfg := g.Config()
+	if e := cfg.Validate(); e != nil {
+		log.Printf("bad game start: %q: %v", line, e)
+		return
+	}
 
 	g.GameStr = fmt.Sprintf("Game#%s", g.ID)
-	g.p = tak.New(tak.Config{Size: g.Size})
-	g.Positions = append(g.Positions, g.p)
+	g.p = tak.New(cfg)
+	g.History = tak.NewGame(g.p)
+	g.History.Repetitions = 0
 	g.bot = b
 	b.NewGame(g)
-	defer b.GameOver()
+	defer func() {
+		// wait for the last GetMove or Ponder to return
+		g.moveLock.Lock()
+		defer g.moveLock.Unlock()
+		b.GameOver()
+	}()
 
-	log.Printf("new game game-id=%q size=%d opponent=%q color=%q time=%q",
-		g.ID, g.Size, g.Opponent, g.Color, g.Time)
+	log.Printf("new game game-id=%q size=%d opponent=%q color=%q time=%q komi=%d pieces=%d caps=%d",
+		g.ID, g.Size, g.Opponent, g.Color, g.Time, g.HalfKomi,
+		g.p.WhiteStones(), g.p.WhiteCaps())
 
 	g.times.mine = g.Time
 	g.times.theirs = g.Time
@@ -105,6 +144,14 @@ func handleMove(ctx context.Context, g *Game, c Client) bool {
 		g.moveLock.Lock()
 		defer g.moveLock.Unlock()
 		defer moveCancel()
+		if pb, ok := g.bot.(Ponderer); ok && p.ToMove() != g.Color {
+			// the opponent may already have moved, while we
+			// waited for the lock
+			if moveCtx.Err() == nil {
+				pb.Ponder(moveCtx, p)
+			}
+			return
+		}
 		mc <- g.bot.GetMove(moveCtx, p, mine, theirs)
 	}(g.p, moves, g.times.mine, g.times.theirs)
 	if g.p.ToMove() != g.Color {
@@ -122,7 +169,7 @@ func handleMove(ctx context.Context, g *Game, c Client) bool {
 				return true
 			}
 		case move := <-moves:
-			next, err := g.p.Move(&move)
+			next, err := g.History.Move(&move)
 			if err != nil {
 				log.Printf("ai returned bad move: %s: %s",
 					ptn.FormatMove(&move), err)
@@ -136,8 +183,6 @@ func handleMove(ctx context.Context, g *Game, c Client) bool {
 				strings.ToUpper(g.p.ToMove().String()[:1]),
 				ptn.FormatMove(&move))
 			g.p = next
-			g.Positions = append(g.Positions, g.p)
-			g.moves = append(g.moves, move)
 			return false
 		case <-timeout:
 			return false
@@ -155,15 +200,25 @@ func handleMove(ctx context.Context, g *Game, c Client) bool {
 		default:
 			continue
 		}
+		if len(bits) < 2 {
+			continue
+		}
 		switch bits[1] {
 		case "P", "M":
-			move, err := playtak.ParseServer(strings.Join(bits[1:], " "))
+			// we cannot follow the game past a move we
+			// cannot play, so resign rather than play blind
+			move, err := playtak.ParseServerSize(strings.Join(bits[1:], " "), g.Size)
 			if err != nil {
-				panic(err)
+				log.Printf("bad-move game-id=%s line=%q err=%q", g.ID, line, err)
+				c.SendCommand(g.GameStr, "Resign")
+				return true
 			}
-			next, err := g.p.Move(&move)
+			next, err := g.History.Move(&move)
 			if err != nil {
-				panic(err)
+				log.Printf("illegal-move game-id=%s move=%q err=%q",
+					g.ID, ptn.FormatMove(&move), err)
+				c.SendCommand(g.GameStr, "Resign")
+				return true
 			}
 			log.Printf("their-move game-id=%s ply=%d ptn=%d.%s move=%q",
 				g.ID,
@@ -172,8 +227,6 @@ func handleMove(ctx context.Context, g *Game, c Client) bool {
 				strings.ToUpper(g.p.ToMove().String()[:1]),
 				ptn.FormatMove(&move))
 			g.p = next
-			g.Positions = append(g.Positions, g.p)
-			g.moves = append(g.moves, move)
 			timeout = time.After(500 * time.Millisecond)
 		case "Abandoned.":
 			log.Printf("game-over game-id=%s opponent=%s ply=%d result=abandoned",
@@ -204,14 +257,18 @@ func handleMove(ctx context.Context, g *Game, c Client) bool {
 			}
 		case "Undo":
 			log.Printf("undo game-id=%s ply=%d", g.ID, g.p.MoveNumber())
-			g.Positions = g.Positions[:len(g.Positions)-1]
-			g.moves = g.moves[:len(g.moves)-1]
-			g.p = g.Positions[len(g.Positions)-1]
+			g.History.Undo()
+			g.p = g.History.Position()
 			return false
 		}
 	}
 }
 
+// Config returns the rules the game is played under.
+func (g *Game) Config() tak.Config {
+	return tak.Config{Size: g.Size, HalfKomi: g.HalfKomi, Reserves: g.Reserves}
+}
+
 func (g *Game) MyTime() time.Duration {
 	return g.times.mine
 }
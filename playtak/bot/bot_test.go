@@ -92,7 +92,7 @@ func TestBasicGame(t *testing.T) {
 	c := NewTestClient(t, transcript)
 	defer c.shutdown()
 	PlayGame(c, bot, startLine)
-	assertPosition(t, bot.game.Positions[len(bot.game.Positions)-1],
+	assertPosition(t, bot.game.History.Position(),
 		`x4,1/x4,1C/x4,1/2,2,x2,1/2,2,x2,1 2 5`)
 }
 
@@ -127,7 +127,7 @@ func TestUndoGame(t *testing.T) {
 	c := NewTestClient(t, transcript)
 	defer c.shutdown()
 	PlayGame(c, bot, startLine)
-	assertPosition(t, bot.game.Positions[len(bot.game.Positions)-1],
+	assertPosition(t, bot.game.History.Position(),
 		`x4,1/x4,1C/x4,1/2,2,x2,1/2,2,x2,1 2 5`)
 }
 
@@ -139,7 +139,7 @@ func TestThinker(t *testing.T) {
 	c := NewTestClient(t, transcript)
 	defer c.shutdown()
 	PlayGame(c, bot, startLine)
-	assertPosition(t, bot.game.Positions[len(bot.game.Positions)-1],
+	assertPosition(t, bot.game.History.Position(),
 		`x4,1/x4,1C/x4,1/2,2,x2,1/2,2,x2,1 2 5`)
 }
 
@@ -175,6 +175,89 @@ func TestResume(t *testing.T) {
 	c := NewTestClient(t, transcript)
 	defer c.shutdown()
 	PlayGame(c, bot, startLine)
-	assertPosition(t, bot.game.Positions[len(bot.game.Positions)-1],
+	assertPosition(t, bot.game.History.Position(),
 		`x4,1/x4,1C/x4,1/2,2,x2,1/2,2,x2,1 2 5`)
 }
+
+func TestBadMove(t *testing.T) {
+	for _, bad := range []string{"M A1 F1 1 1 1 1 1", "M E2 E1 1", "P Q9"} {
+		bot, transcript := setupGame(defaultGame)
+		// the bot cannot follow the game, so it resigns
+		transcript = append(transcript[:1:1], Expectation{
+			send: []string{"Game#100 " + bad},
+			recv: []string{"Game#100 Resign"},
+		})
+
+		c := NewTestClient(t, transcript)
+		PlayGame(c, bot, startLine)
+		c.shutdown()
+		assertPosition(t, bot.game.History.Position(),
+			`x5/x5/x5/x5/2,x4 2 1`)
+	}
+}
+
+func TestParseGameStartKomi(t *testing.T) {
+	g := parseGameStart("Game Start 100 6 Taktician vs HonestJoe black 600 5 30 1")
+	if g.Size != 6 || g.Color != tak.Black || g.Opponent != "Taktician" {
+		t.Fatalf("bad game: %#v", g)
+	}
+	if g.HalfKomi != 5 {
+		t.Fatalf("komi=%d", g.HalfKomi)
+	}
+	g = parseGameStart(startLine)
+	if g.HalfKomi != 0 {
+		t.Fatalf("komi=%d", g.HalfKomi)
+	}
+}
+
+func TestParseGameStartReserves(t *testing.T) {
+	g := parseGameStart("Game Start 100 5 Taktician vs HonestJoe white 600 0 25 0")
+	if g.Reserves == nil {
+		t.Fatalf("no reserves")
+	}
+	p := tak.New(g.Config())
+	if p.WhiteStones() != 25 || p.WhiteCaps() != 0 ||
+		p.BlackStones() != 25 || p.BlackCaps() != 0 {
+		t.Fatalf("reserves=%+v", *g.Reserves)
+	}
+	g = parseGameStart(startLine)
+	if g.Reserves != nil {
+		t.Fatalf("reserves=%+v", *g.Reserves)
+	}
+}
+
+func TestBadGameStart(t *testing.T) {
+	bot, _ := setupGame(defaultGame)
+	c := NewTestClient(t, nil)
+	defer c.shutdown()
+	PlayGame(c, bot, "Game Start 100 9 Taktician vs HonestJoe white 600")
+	if bot.game != nil {
+		t.Fatalf("started a game of size %d", bot.game.Size)
+	}
+}
+
+func TestPonder(t *testing.T) {
+	base, transcript := setupGame(defaultGame)
+	bot := &TestBotPonder{TestBotStatic: *base}
+
+	c := NewTestClient(t, transcript)
+	defer c.shutdown()
+	PlayGame(c, bot, startLine)
+	assertPosition(t, bot.game.History.Position(),
+		`x4,1/x4,1C/x4,1/2,2,x2,1/2,2,x2,1 2 5`)
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	// a ponder may be skipped if the opponent moves first, but
+	// never run out of order or on our own turn
+	for i, ply := range bot.pondered {
+		if ply%2 != 1 || (i > 0 && ply <= bot.pondered[i-1]) {
+			t.Fatalf("pondered plies %v", bot.pondered)
+		}
+	}
+	if bot.theirs {
+		t.Fatal("GetMove called on the opponent's turn")
+	}
+	if !bot.gameOver {
+		t.Fatal("GameOver not called")
+	}
+}
@@ -145,3 +145,32 @@ func (t *TestBotResume) GetMove(ctx context.Context,
 	}
 	return t.TestBotStatic.GetMove(ctx, p, mine, theirs)
 }
+
+type TestBotPonder struct {
+	TestBotStatic
+	mu       sync.Mutex
+	pondered []int
+	// theirs is set if GetMove is called on the opponent's turn
+	theirs   bool
+	gameOver bool
+}
+
+func (t *TestBotPonder) GetMove(ctx context.Context,
+	p *tak.Position,
+	mine, theirs time.Duration) tak.Move {
+	if p.ToMove() != t.game.Color {
+		t.theirs = true
+	}
+	return t.TestBotStatic.GetMove(ctx, p, mine, theirs)
+}
+
+func (t *TestBotPonder) Ponder(ctx context.Context, p *tak.Position) {
+	t.mu.Lock()
+	t.pondered = append(t.pondered, p.MoveNumber())
+	t.mu.Unlock()
+	<-ctx.Done()
+}
+
+func (t *TestBotPonder) GameOver() {
+	t.gameOver = true
+}
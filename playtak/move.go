@@ -6,89 +6,182 @@ import (
 	"strconv"
 	"strings"
 
+	"../ptn"
 	"../tak"
 )
 
-func parseSquare(square string) (x, y int, err error) {
+// A NotationError reports a move in server notation, or in PTN on
+// its way to server notation, that cannot be converted.
+type NotationError struct {
+	Move   string
+	Reason string
+}
+
+func (e *NotationError) Error() string {
+	return fmt.Sprintf("bad move %q: %s", e.Move, e.Reason)
+}
+
+// parseSquare parses a square such as `A1` or `a1` on a board of
+// `size`.
+func parseSquare(square string, size int) (x, y int, ok bool) {
 	if len(square) != 2 {
-		return 0, 0, fmt.Errorf("bad coord `%s'", square)
+		return 0, 0, false
 	}
-	if square[0] < 'A' || square[0] > 'H' {
-		return 0, 0, fmt.Errorf("bad rank %s", square)
+	file := square[0] | 0x20
+	if file < 'a' || int(file-'a') >= size {
+		return 0, 0, false
 	}
-	if square[1] < '1' || square[1] > '8' {
-		return 0, 0, fmt.Errorf("bad file %s", square)
+	if square[1] < '1' || int(square[1]-'1') >= size {
+		return 0, 0, false
 	}
-	return int(square[0] - 'A'), int(square[1] - '1'), nil
+	return int(file - 'a'), int(square[1] - '1'), true
 }
 
 func formatSquare(x, y int) string {
 	return string([]byte{byte(x) + 'A', byte(y) + '1'})
 }
 
+// ParseServer parses a move in server notation, such as `P A1 C` or
+// `M A1 A3 2 1`, on a board of the largest size.
 func ParseServer(server string) (tak.Move, error) {
-	words := strings.Split(server, " ")
-	switch words[0] {
+	return ParseServerSize(server, 8)
+}
+
+// ParseServerSize parses a move in server notation on a board of
+// `size`. Words may be separated by any white space, and squares and
+// piece letters written in either case. The move is checked against
+// the board as by CheckMove.
+func ParseServerSize(server string, size int) (tak.Move, error) {
+	bad := func(reason string) (tak.Move, error) {
+		return tak.Move{}, &NotationError{Move: server, Reason: reason}
+	}
+	words := strings.Fields(server)
+	if len(words) < 2 {
+		return bad("command too short")
+	}
+	x, y, ok := parseSquare(words[1], size)
+	if !ok {
+		return bad(fmt.Sprintf("bad square %s", words[1]))
+	}
+	m := tak.Move{X: x, Y: y}
+	switch strings.ToUpper(words[0]) {
 	case "P":
-		if len(words) != 2 && len(words) != 3 {
-			return tak.Move{}, fmt.Errorf("command too short: %s", server)
-		}
-		x, y, err := parseSquare(words[1])
-		if err != nil {
-			return tak.Move{}, err
-		}
-		m := tak.Move{
-			X: x, Y: y, Type: tak.PlaceFlat,
-		}
-		if len(words) == 3 {
-			switch words[2] {
-			case "C":
-				m.Type = tak.PlaceCapstone
-			case "W":
-				m.Type = tak.PlaceStanding
-			default:
-				return tak.Move{}, fmt.Errorf("bad place: %s", server)
-			}
+		m.Type = tak.PlaceFlat
+		switch {
+		case len(words) == 2:
+		case len(words) > 3:
+			return bad("too many words")
+		case strings.EqualFold(words[2], "C"):
+			m.Type = tak.PlaceCapstone
+		case strings.EqualFold(words[2], "W"):
+			m.Type = tak.PlaceStanding
+		default:
+			return bad(fmt.Sprintf("bad piece %s", words[2]))
 		}
-		return m, nil
-
 	case "M":
 		if len(words) < 4 {
-			return tak.Move{}, fmt.Errorf("command too short: %s", server)
+			return bad("command too short")
 		}
-		sx, sy, err := parseSquare(words[1])
-		if err != nil {
-			return tak.Move{}, err
+		ex, ey, ok := parseSquare(words[2], size)
+		if !ok {
+			return bad(fmt.Sprintf("bad square %s", words[2]))
 		}
-		ex, ey, err := parseSquare(words[2])
-		if err != nil {
-			return tak.Move{}, err
-		}
-		m := tak.Move{X: sx, Y: sy}
 		switch {
-		case ex > sx && ey == sy:
+		case ex > x && ey == y:
 			m.Type = tak.SlideRight
-		case ex < sx && ey == sy:
+		case ex < x && ey == y:
 			m.Type = tak.SlideLeft
-		case ey > sy && ex == sx:
+		case ey > y && ex == x:
 			m.Type = tak.SlideUp
-		case ey < sy && ex == sx:
+		case ey < y && ex == x:
 			m.Type = tak.SlideDown
 		default:
-			return tak.Move{}, fmt.Errorf("bad slide: %s", server)
+			return bad("slide is not along a line")
+		}
+		if d := ex - x + ey - y; d != len(words)-3 && -d != len(words)-3 {
+			return bad(fmt.Sprintf("%d drops for a slide of %d squares",
+				len(words)-3, abs(d)))
 		}
 		m.Slides = make([]byte, len(words)-3)
 		for i, drop := range words[3:] {
 			n, e := strconv.Atoi(drop)
-			if e != nil {
-				return tak.Move{}, fmt.Errorf("bad drop: %s", server)
+			if e != nil || n < 1 || n > size {
+				return bad(fmt.Sprintf("bad drop %s", drop))
 			}
 			m.Slides[i] = byte(n)
 		}
-		return m, nil
 	default:
-		return tak.Move{}, fmt.Errorf("bad command: %s", server)
+		return bad(fmt.Sprintf("unknown command %s", words[0]))
+	}
+	if e := CheckMove(&m, size); e != "" {
+		return bad(e)
+	}
+	return m, nil
+}
+
+// CheckMove returns why `m` cannot be played on a board of `size`
+// whatever the position, or "" if it might be: its squares must be
+// on the board, and a slide must drop at least one stone on each
+// square and carry no more than `size`.
+func CheckMove(m *tak.Move, size int) string {
+	if m.X < 0 || m.Y < 0 || m.X >= size || m.Y >= size {
+		return "square off the board"
+	}
+	switch m.Type {
+	case tak.PlaceFlat, tak.PlaceStanding, tak.PlaceCapstone:
+		return ""
+	case tak.SlideLeft, tak.SlideRight, tak.SlideUp, tak.SlideDown:
+	default:
+		return "bad move type"
+	}
+	if len(m.Slides) == 0 {
+		return "slide without drops"
+	}
+	carry := 0
+	for _, s := range m.Slides {
+		if s == 0 {
+			return "empty drop"
+		}
+		carry += int(s)
+	}
+	if carry > size {
+		return fmt.Sprintf("carries %d stones on a %dx%d board", carry, size, size)
+	}
+	ex, ey := m.Dest()
+	if ex < 0 || ey < 0 || ex >= size || ey >= size {
+		return "slide off the board"
+	}
+	return ""
+}
+
+// ServerToPTN converts a move in server notation on a board of
+// `size` to PTN.
+func ServerToPTN(server string, size int) (string, error) {
+	m, e := ParseServerSize(server, size)
+	if e != nil {
+		return "", e
+	}
+	return ptn.FormatMove(&m), nil
+}
+
+// PTNToServer converts a PTN move on a board of `size` to server
+// notation.
+func PTNToServer(move string, size int) (string, error) {
+	m, e := ptn.ParseMove(move)
+	if e != nil {
+		return "", &NotationError{Move: move, Reason: e.Error()}
+	}
+	if e := CheckMove(&m, size); e != "" {
+		return "", &NotationError{Move: move, Reason: e}
+	}
+	return FormatServer(&m), nil
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
 	}
+	return x
 }
 
 func FormatServer(m *tak.Move) string {
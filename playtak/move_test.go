@@ -1,9 +1,11 @@
 package playtak
 
 import (
+	"math/rand"
 	"reflect"
 	"testing"
 
+	"../ptn"
 	"../tak"
 )
 
@@ -74,3 +76,99 @@ func TestParseServer(t *testing.T) {
 		}
 	}
 }
+
+func TestParseServerVariants(t *testing.T) {
+	want := tak.Move{X: 2, Y: 0, Type: tak.SlideUp, Slides: []byte{4, 1}}
+	for _, in := range []string{
+		"M C1 C3 4 1",
+		"m c1 c3 4 1",
+		"M  c1\tC3 4 1 ",
+	} {
+		m, e := ParseServer(in)
+		if e != nil || !reflect.DeepEqual(m, want) {
+			t.Errorf("parse(%q) = %#v, %v", in, m, e)
+		}
+	}
+	if m, e := ParseServer("p b2 w"); e != nil || m.Type != tak.PlaceStanding {
+		t.Errorf("parse(p b2 w) = %#v, %v", m, e)
+	}
+}
+
+func TestParseServerErrors(t *testing.T) {
+	cases := []struct {
+		in   string
+		size int
+	}{
+		{"", 5},
+		{"P", 5},
+		{"X A1", 5},
+		{"P A1 F", 5},
+		{"P A1 C W", 5},
+		{"P F1", 5},
+		{"P A6", 5},
+		{"P A0", 5},
+		{"M A1 A3", 5},
+		{"M A1 A3 1", 5},
+		{"M A1 A2 1 1", 5},
+		{"M A1 B2 1", 5},
+		{"M A1 A1 1", 5},
+		{"M A1 A2 0", 5},
+		{"M A1 A2 x", 5},
+		{"M A1 A3 3 3", 5},
+		{"M A1 A6 1 1 1 1 1", 5},
+		{"M A1 A2 4", 3},
+	}
+	for _, tc := range cases {
+		m, e := ParseServerSize(tc.in, tc.size)
+		if e == nil {
+			t.Errorf("parse(%q, %d) = %#v", tc.in, tc.size, m)
+			continue
+		}
+		if _, ok := e.(*NotationError); !ok {
+			t.Errorf("parse(%q, %d): %T %v", tc.in, tc.size, e, e)
+		}
+	}
+	for _, bad := range []string{"a6", "6a1>6", "a1>4", "Ce9"} {
+		if s, e := PTNToServer(bad, 5); e == nil {
+			t.Errorf("PTNToServer(%q) = %q", bad, s)
+		}
+	}
+}
+
+func TestServerAllMoves(t *testing.T) {
+	r := rand.New(rand.NewSource(20))
+	for size := 3; size <= 8; size++ {
+		for game := 0; game < 10; game++ {
+			p := tak.New(tak.Config{Size: size})
+			for ply := 0; ply < 40; ply++ {
+				for _, m := range p.AllMoves(nil) {
+					server := FormatServer(&m)
+					back, e := ParseServerSize(server, size)
+					if e != nil {
+						t.Fatalf("parse(%q, %d): %v", server, size, e)
+					}
+					if !back.Equal(&m) {
+						t.Fatalf("parse(%q) = %#v != %#v", server, back, m)
+					}
+					pt, e := ServerToPTN(server, size)
+					if e != nil || pt != ptn.FormatMove(&m) {
+						t.Fatalf("ServerToPTN(%q) = %q, %v", server, pt, e)
+					}
+					s, e := PTNToServer(pt, size)
+					if e != nil || s != server {
+						t.Fatalf("PTNToServer(%q) = %q, %v", pt, s, e)
+					}
+				}
+				moves := p.LegalMoves(nil)
+				next, e := p.Move(&moves[r.Intn(len(moves))])
+				if e != nil {
+					t.Fatal(e)
+				}
+				if over, _ := next.GameOver(); over {
+					break
+				}
+				p = next
+			}
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"../../playtak"
+	"../../ptn"
+	"../../tak"
+)
+
+// A game is a game in progress between two clients.
+type game struct {
+	s        *Server
+	id       int
+	players  [2]*conn
+	size     int
+	time     time.Duration
+	inc      time.Duration
+	halfKomi int
+	reserves tak.Reserves
+
+	// The server adjudicates only roads, flats, resignation and
+	// time, so history draws by neither repetition nor length.
+	history   *tak.Game
+	observers map[*conn]bool
+
+	// clock is the time each player has left, as of `started`,
+	// when the player to move began thinking. `timer` flags them
+	// when their time runs out.
+	clock   [2]time.Duration
+	started time.Time
+	timer   *time.Timer
+	turn    int
+
+	undo [2]bool
+	draw [2]bool
+}
+
+func newGame(s *Server, id int, white, black *conn, sk *seek) *game {
+	g := &game{
+		s:         s,
+		id:        id,
+		players:   [2]*conn{white, black},
+		size:      sk.size,
+		time:      sk.time,
+		inc:       sk.inc,
+		halfKomi:  sk.halfKomi,
+		reserves:  sk.reserves,
+		observers: make(map[*conn]bool),
+		clock:     [2]time.Duration{sk.time, sk.time},
+	}
+	g.history = tak.NewGame(tak.New(tak.Config{
+		Size:     g.size,
+		HalfKomi: g.halfKomi,
+		Reserves: &g.reserves,
+	}))
+	g.history.Repetitions = 0
+	return g
+}
+
+// String formats the game as in GameList and Observe messages.
+func (g *game) String() string {
+	return fmt.Sprintf("Game#%d %s vs %s, %dx%d, %d, %d, %d half-moves played, %s to move",
+		g.id, g.players[0].name, g.players[1].name, g.size, g.size,
+		int(g.time/time.Second), int(g.inc/time.Second),
+		g.history.Plies(), g.toMove())
+}
+
+func (g *game) toMove() tak.Color {
+	return g.history.Position().ToMove()
+}
+
+// player returns the index in `players` of the player of color `c`.
+func player(c tak.Color) int {
+	if c == tak.White {
+		return 0
+	}
+	return 1
+}
+
+// send sends a line about the game to both players and everyone
+// watching, except `skip`.
+func (g *game) send(skip *conn, format string, args ...interface{}) {
+	line := fmt.Sprintf("Game#%d ", g.id) + fmt.Sprintf(format, args...)
+	for _, c := range g.players {
+		if c != skip {
+			c.send("%s", line)
+		}
+	}
+	for c := range g.observers {
+		if c != skip {
+			c.send("%s", line)
+		}
+	}
+}
+
+func (g *game) sendTime() {
+	g.send(nil, "Time %d %d", seconds(g.clock[0]), seconds(g.clock[1]))
+}
+
+func seconds(d time.Duration) int {
+	if d < 0 {
+		return 0
+	}
+	return int(d / time.Second)
+}
+
+func (g *game) start() {
+	for i, c := range g.players {
+		color := "white"
+		if i == 1 {
+			color = "black"
+		}
+		c.send("Game Start %d %d %s vs %s %s %d %d %d %d",
+			g.id, g.size, g.players[0].name, g.players[1].name, color,
+			int(g.time/time.Second), g.halfKomi,
+			g.reserves.WhiteStones, g.reserves.WhiteCaps)
+	}
+	g.startClock()
+}
+
+// replay sends the moves so far to an observer who has just joined.
+func (g *game) replay(c *conn) {
+	for i := range g.history.Moves {
+		c.send("Game#%d %s", g.id, playtak.FormatServer(&g.history.Moves[i]))
+	}
+	g.charge()
+	c.send("Game#%d Time %d %d", g.id, seconds(g.clock[0]), seconds(g.clock[1]))
+}
+
+// charge deducts the time the player to move has spent so far.
+func (g *game) charge() {
+	now := time.Now()
+	g.clock[player(g.toMove())] -= now.Sub(g.started)
+	g.started = now
+}
+
+// startClock starts the clock of the player to move.
+func (g *game) startClock() {
+	if g.timer != nil {
+		g.timer.Stop()
+	}
+	g.started = time.Now()
+	g.turn++
+	turn := g.turn
+	g.timer = time.AfterFunc(g.clock[player(g.toMove())], func() {
+		g.s.mu.Lock()
+		defer g.s.mu.Unlock()
+		if g.s.games[g.id] == g && g.turn == turn {
+			g.flag()
+		}
+	})
+}
+
+// flag ends the game if the player to move is out of time, and
+// reports whether it did.
+func (g *game) flag() bool {
+	g.charge()
+	if g.clock[player(g.toMove())] > 0 {
+		return false
+	}
+	g.sendTime()
+	if g.toMove() == tak.White {
+		g.over("0-1")
+	} else {
+		g.over("1-0")
+	}
+	return true
+}
+
+// over ends the game with `result`.
+func (g *game) over(result string) {
+	g.timer.Stop()
+	g.send(nil, "Over %s", result)
+	g.end()
+}
+
+// abandon ends the game because `quitter` has disconnected.
+func (g *game) abandon(quitter *conn) {
+	g.timer.Stop()
+	g.send(quitter, "Abandoned. %s quit", quitter.name)
+	g.end()
+}
+
+func (g *game) end() {
+	delete(g.s.games, g.id)
+	g.s.broadcast("GameList Remove %s", g)
+}
+
+// gameCommand handles a `Game#<id> ...` command from `c`.
+func (s *Server) gameCommand(c *conn, words []string) {
+	id, _ := strconv.Atoi(strings.TrimPrefix(words[0], "Game#"))
+	g := s.games[id]
+	if g == nil || len(words) < 2 || (g.players[0] != c && g.players[1] != c) {
+		c.send("NOK")
+		return
+	}
+	me := 0
+	if g.players[1] == c {
+		me = 1
+	}
+	them := g.players[1-me]
+	switch words[1] {
+	case "P", "M":
+		if me != player(g.toMove()) {
+			c.send("NOK")
+			return
+		}
+		m, e := playtak.ParseServerSize(strings.Join(words[1:], " "), g.size)
+		if e != nil {
+			c.send("NOK")
+			return
+		}
+		if g.flag() {
+			return
+		}
+		if _, e := g.history.Move(&m); e != nil {
+			c.send("NOK")
+			return
+		}
+		g.clock[me] += g.inc
+		g.undo = [2]bool{}
+		g.draw = [2]bool{}
+		g.send(c, "%s", playtak.FormatServer(&m))
+		g.sendTime()
+		if d := g.history.WinDetails(); d.Over {
+			g.over(ptn.FormatResult(d))
+			return
+		}
+		g.startClock()
+	case "Resign":
+		d := tak.WinDetails{Over: true, Reason: tak.Resignation, Winner: tak.White}
+		if me == 0 {
+			d.Winner = tak.Black
+		}
+		g.over(ptn.FormatResult(d))
+	case "OfferDraw":
+		g.draw[me] = true
+		if g.draw[1-me] {
+			g.over("1/2-1/2")
+			return
+		}
+		them.send("Game#%d OfferDraw", g.id)
+	case "RemoveDraw":
+		g.draw[me] = false
+		them.send("Game#%d RemoveDraw", g.id)
+	case "RequestUndo":
+		if g.history.Plies() == 0 {
+			c.send("NOK")
+			return
+		}
+		g.undo[me] = true
+		if !g.undo[1-me] {
+			them.send("Game#%d RequestUndo", g.id)
+			return
+		}
+		g.charge()
+		g.history.Undo()
+		g.undo = [2]bool{}
+		g.send(nil, "Undo")
+		g.startClock()
+	case "RemoveUndo":
+		g.undo[me] = false
+		them.send("Game#%d RemoveUndo", g.id)
+	default:
+		c.send("NOK")
+	}
+}
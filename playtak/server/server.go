@@ -0,0 +1,371 @@
+// Package server implements the text protocol of the playtak.com
+// game server, so that clients, bots and loggers can be run against
+// a server on localhost.
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"../../tak"
+)
+
+// sendBuffer is the number of lines that may be queued for a
+// connection before the server gives up on it as stuck.
+const sendBuffer = 1024
+
+// A Server is a playtak.com-compatible game server. The zero Server
+// is ready to use, and accepts any user name and password.
+type Server struct {
+	// Passwords, if non-nil, holds the password of each registered
+	// user; anyone else must log in as Guest.
+	Passwords map[string]string
+	// Debug logs every line sent and received.
+	Debug bool
+
+	mu       sync.Mutex
+	users    map[string]*conn
+	seeks    map[int]*seek
+	games    map[int]*game
+	nextSeek int
+	nextGame int
+	guests   int
+}
+
+// A conn is a client connection, which is anonymous until it logs
+// in.
+type conn struct {
+	s    *Server
+	nc   net.Conn
+	name string
+	out  chan string
+	// closed is set once out has been closed, after which lines
+	// to the connection are dropped.
+	closed bool
+}
+
+// A seek is an open offer to play a game.
+type seek struct {
+	id       int
+	c        *conn
+	size     int
+	time     time.Duration
+	inc      time.Duration
+	color    string
+	halfKomi int
+	reserves tak.Reserves
+}
+
+func (sk *seek) String() string {
+	return fmt.Sprintf("%d %s %d %d %d %s %d %d %d",
+		sk.id, sk.c.name, sk.size,
+		int(sk.time/time.Second), int(sk.inc/time.Second),
+		sk.color, sk.halfKomi,
+		sk.reserves.WhiteStones, sk.reserves.WhiteCaps)
+}
+
+// ListenAndServe listens on the TCP address `addr` and serves
+// clients connecting to it.
+func (s *Server) ListenAndServe(addr string) error {
+	l, e := net.Listen("tcp", addr)
+	if e != nil {
+		return e
+	}
+	return s.Serve(l)
+}
+
+// Serve serves clients connecting to `l`, until accepting a
+// connection fails.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.users == nil {
+		s.users = make(map[string]*conn)
+		s.seeks = make(map[int]*seek)
+		s.games = make(map[int]*game)
+	}
+	s.mu.Unlock()
+	for {
+		nc, e := l.Accept()
+		if e != nil {
+			return e
+		}
+		go s.serveConn(nc)
+	}
+}
+
+func (s *Server) serveConn(nc net.Conn) {
+	c := &conn{s: s, nc: nc, out: make(chan string, sendBuffer)}
+	go c.writeLines()
+	s.mu.Lock()
+	c.send("Welcome!")
+	c.send("Login or Register")
+	s.mu.Unlock()
+
+	r := bufio.NewScanner(nc)
+	for r.Scan() {
+		line := strings.TrimRight(r.Text(), "\r")
+		if s.Debug {
+			log.Printf("[%s] < %s", c, line)
+		}
+		s.mu.Lock()
+		quit := s.command(c, line)
+		s.mu.Unlock()
+		if quit {
+			break
+		}
+	}
+
+	s.mu.Lock()
+	s.disconnect(c)
+	s.mu.Unlock()
+}
+
+func (c *conn) String() string {
+	if c.name == "" {
+		return c.nc.RemoteAddr().String()
+	}
+	return c.name
+}
+
+// send queues a line for the client. It must be called with the
+// server locked. A client too slow to keep up is disconnected.
+func (c *conn) send(format string, args ...interface{}) {
+	if c.closed {
+		return
+	}
+	line := fmt.Sprintf(format, args...)
+	if c.s.Debug {
+		log.Printf("[%s] > %s", c, line)
+	}
+	select {
+	case c.out <- line:
+	default:
+		log.Printf("[%s] send buffer full, disconnecting", c)
+		c.nc.Close()
+	}
+}
+
+func (c *conn) writeLines() {
+	w := bufio.NewWriter(c.nc)
+	for line := range c.out {
+		fmt.Fprintf(w, "%s\n", line)
+		if len(c.out) == 0 {
+			if w.Flush() != nil {
+				c.nc.Close()
+			}
+		}
+	}
+	c.nc.Close()
+}
+
+// broadcast sends a line to every logged-in client.
+func (s *Server) broadcast(format string, args ...interface{}) {
+	for _, c := range s.users {
+		c.send(format, args...)
+	}
+}
+
+// command handles one line from `c`, and returns true if the client
+// asked to disconnect.
+func (s *Server) command(c *conn, line string) bool {
+	words := strings.Fields(line)
+	if len(words) == 0 {
+		return false
+	}
+	switch words[0] {
+	case "PING", "Client":
+		c.send("OK")
+		return false
+	case "quit":
+		return true
+	case "Login":
+		s.login(c, words[1:])
+		return false
+	}
+	if c.name == "" {
+		c.send("NOK")
+		return false
+	}
+	switch {
+	case words[0] == "Seek":
+		s.seek(c, words[1:])
+	case words[0] == "Accept" && len(words) == 2:
+		s.accept(c, words[1])
+	case words[0] == "Observe" && len(words) == 2:
+		s.observe(c, words[1], true)
+	case words[0] == "Unobserve" && len(words) == 2:
+		s.observe(c, words[1], false)
+	case words[0] == "GameList":
+		for _, g := range s.games {
+			c.send("GameList Add %s", g)
+		}
+	case words[0] == "Shout" && len(words) > 1:
+		msg := strings.TrimSpace(strings.TrimPrefix(line, "Shout"))
+		s.broadcast("Shout <%s> %s", c.name, msg)
+	case strings.HasPrefix(words[0], "Game#"):
+		s.gameCommand(c, words)
+	default:
+		c.send("NOK")
+	}
+	return false
+}
+
+func (s *Server) login(c *conn, words []string) {
+	if c.name != "" {
+		c.send("You're already logged in")
+		return
+	}
+	if len(words) == 0 || len(words) > 2 {
+		c.send("NOK")
+		return
+	}
+	name := words[0]
+	if name == "Guest" {
+		s.guests++
+		name = fmt.Sprintf("Guest%d", s.guests)
+	} else if s.Passwords != nil {
+		pass, ok := s.Passwords[name]
+		if !ok || len(words) != 2 || words[1] != pass {
+			c.send("Authentication failure")
+			c.send("Login or Register")
+			return
+		}
+	}
+	if s.users[name] != nil {
+		c.send("You're already logged in")
+		return
+	}
+	c.name = name
+	s.users[name] = c
+	c.send("Welcome %s!", name)
+	c.send("Online %d", len(s.users))
+	for _, sk := range s.seeks {
+		c.send("Seek new %s", sk)
+	}
+	for _, g := range s.games {
+		c.send("GameList Add %s", g)
+	}
+}
+
+// seek handles `Seek <size> <time> <increment> [<color> [<komi>
+// <pieces> <capstones>]]`, replacing any seek `c` already has. A
+// size of 0 withdraws the seek; a negative piece count asks for the
+// standard count.
+func (s *Server) seek(c *conn, words []string) {
+	s.removeSeek(c)
+	if len(words) >= 1 && words[0] == "0" {
+		return
+	}
+	if len(words) != 3 && len(words) != 4 && len(words) != 7 {
+		c.send("NOK")
+		return
+	}
+	// size, time, increment, komi, pieces and capstones
+	nums := []int{0, 0, 0, 0, -1, -1}
+	fields := words[:3:3]
+	if len(words) == 7 {
+		fields = append(fields, words[4:]...)
+	}
+	for i, w := range fields {
+		n, e := strconv.Atoi(w)
+		if e != nil {
+			c.send("NOK")
+			return
+		}
+		nums[i] = n
+	}
+	sk := &seek{
+		c:        c,
+		size:     nums[0],
+		time:     time.Duration(nums[1]) * time.Second,
+		inc:      time.Duration(nums[2]) * time.Second,
+		color:    "A",
+		halfKomi: nums[3],
+	}
+	if len(words) > 3 {
+		sk.color = strings.ToUpper(words[3])
+	}
+	if sk.size < 3 || sk.size > 8 || sk.time <= 0 || sk.inc < 0 ||
+		sk.halfKomi < 0 || (sk.color != "W" && sk.color != "B" && sk.color != "A") {
+		c.send("NOK")
+		return
+	}
+	sk.reserves = *tak.ReservesFor(sk.size, nums[4], nums[5])
+	if !sk.reserves.Valid() {
+		c.send("NOK")
+		return
+	}
+	s.nextSeek++
+	sk.id = s.nextSeek
+	s.seeks[sk.id] = sk
+	s.broadcast("Seek new %s", sk)
+}
+
+func (s *Server) removeSeek(c *conn) {
+	for id, sk := range s.seeks {
+		if sk.c == c {
+			delete(s.seeks, id)
+			s.broadcast("Seek remove %s", sk)
+		}
+	}
+}
+
+func (s *Server) accept(c *conn, id string) {
+	n, _ := strconv.Atoi(id)
+	sk := s.seeks[n]
+	if sk == nil || sk.c == c {
+		c.send("NOK")
+		return
+	}
+	s.removeSeek(sk.c)
+	s.removeSeek(c)
+	white, black := sk.c, c
+	if sk.color == "B" || (sk.color == "A" && rand.Intn(2) == 0) {
+		white, black = black, white
+	}
+	s.nextGame++
+	g := newGame(s, s.nextGame, white, black, sk)
+	s.games[g.id] = g
+	g.start()
+	s.broadcast("GameList Add %s", g)
+}
+
+func (s *Server) observe(c *conn, id string, on bool) {
+	n, _ := strconv.Atoi(id)
+	g := s.games[n]
+	if g == nil {
+		c.send("NOK")
+		return
+	}
+	if !on {
+		delete(g.observers, c)
+		return
+	}
+	g.observers[c] = true
+	c.send("Observe %s", g)
+	g.replay(c)
+}
+
+// disconnect forgets `c`, withdrawing its seek and abandoning its
+// games.
+func (s *Server) disconnect(c *conn) {
+	if c.name != "" {
+		s.removeSeek(c)
+		for _, g := range s.games {
+			delete(g.observers, c)
+			if g.players[0] == c || g.players[1] == c {
+				g.abandon(c)
+			}
+		}
+		delete(s.users, c.name)
+	}
+	c.closed = true
+	close(c.out)
+}
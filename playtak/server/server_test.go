@@ -0,0 +1,246 @@
+package server
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"../../playtak"
+	"../../playtak/bot"
+	"../../ptn"
+	"../../tak"
+)
+
+func startServer(t *testing.T, s *Server) string {
+	l, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	go s.Serve(l)
+	t.Cleanup(func() { l.Close() })
+	return l.Addr().String()
+}
+
+func connect(t *testing.T, addr, user, pass string) *playtak.Client {
+	c := &playtak.Client{}
+	if e := c.Connect(addr); e != nil {
+		t.Fatal(e)
+	}
+	t.Cleanup(func() { disconnect(c) })
+	c.SendClient("test")
+	if e := c.Login(user, pass); e != nil {
+		t.Fatalf("login %s: %v", user, e)
+	}
+	return c
+}
+
+// disconnect asks the server to hang up, so that the client's
+// reader sees the connection close and Shutdown can return.
+func disconnect(c *playtak.Client) {
+	c.SendCommand("quit")
+	c.Shutdown()
+}
+
+// expect reads lines from `c` until one starting with `prefix`, and
+// returns it.
+func expect(t *testing.T, c *playtak.Client, prefix string) string {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line, ok := <-c.Recv():
+			if !ok {
+				t.Fatalf("disconnected waiting for %q", prefix)
+			}
+			if strings.HasPrefix(line, prefix) {
+				return line
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %q", prefix)
+		}
+	}
+}
+
+// startGame has `white` seek a game that `black` accepts, and returns
+// the game's prefix.
+func startGame(t *testing.T, white, black *playtak.Client, seek ...string) string {
+	white.SendCommand(append([]string{"Seek"}, seek...)...)
+	id := strings.Fields(expect(t, black, "Seek new"))[2]
+	black.SendCommand("Accept", id)
+	start := strings.Fields(expect(t, white, "Game Start"))
+	if start[7] != "white" {
+		t.Fatalf("seeker plays %s", start[7])
+	}
+	expect(t, black, "Game Start")
+	return "Game#" + start[2]
+}
+
+func TestLogin(t *testing.T) {
+	addr := startServer(t, &Server{Passwords: map[string]string{"alice": "secret"}})
+	connect(t, addr, "alice", "secret")
+	c := connect(t, addr, "Guest", "")
+	c.SendCommand("Shout", "hello", "there")
+	if who, msg := playtak.ParseShout(expect(t, c, "Shout")); who != "Guest1" || msg != "hello there" {
+		t.Fatalf("shout from %q: %q", who, msg)
+	}
+
+	for _, pass := range []string{"wrong", "secret"} {
+		bad := &playtak.Client{}
+		if e := bad.Connect(addr); e != nil {
+			t.Fatal(e)
+		}
+		if e := bad.Login("alice", pass); e == nil {
+			t.Fatalf("logged in with password %q", pass)
+		}
+		disconnect(bad)
+	}
+}
+
+func TestRoadWin(t *testing.T) {
+	addr := startServer(t, &Server{})
+	white := connect(t, addr, "white", "")
+	black := connect(t, addr, "black", "")
+	game := startGame(t, white, black, "5", "60", "5", "W", "4", "21", "1")
+
+	watcher := connect(t, addr, "watcher", "")
+	add := strings.Fields(expect(t, watcher, "GameList Add "+game))
+	watcher.SendCommand("Observe", strings.TrimPrefix(add[2], "Game#"))
+	expect(t, watcher, "Observe "+game)
+
+	moves := []string{"P A1", "P E5", "P E4", "P A2", "P E3", "P A3", "P E2", "P A4", "P E1"}
+	for i, m := range moves {
+		mover, other := white, black
+		if i%2 == 1 {
+			mover, other = black, white
+		}
+		mover.SendCommand(game, m)
+		expect(t, other, game+" "+m)
+		expect(t, watcher, game+" "+m)
+		tm := strings.Fields(expect(t, watcher, game+" Time"))
+		if left, _ := strconv.Atoi(tm[2+i%2]); left <= 60 {
+			t.Fatalf("move %d: no increment: %v", i, tm)
+		}
+	}
+	for _, c := range []*playtak.Client{white, black, watcher} {
+		if over := expect(t, c, game+" Over"); over != game+" Over R-0" {
+			t.Fatalf("result %q", over)
+		}
+	}
+}
+
+func TestIllegalMove(t *testing.T) {
+	addr := startServer(t, &Server{})
+	white := connect(t, addr, "white", "")
+	black := connect(t, addr, "black", "")
+	game := startGame(t, white, black, "5", "60", "0", "W")
+
+	black.SendCommand(game, "P A1")
+	expect(t, black, "NOK")
+	white.SendCommand(game, "P A1 C")
+	expect(t, white, "NOK")
+	white.SendCommand(game, "M A1 A2 1")
+	expect(t, white, "NOK")
+	white.SendCommand(game, "P A1")
+	expect(t, black, game+" P A1")
+}
+
+func TestUndo(t *testing.T) {
+	addr := startServer(t, &Server{})
+	white := connect(t, addr, "white", "")
+	black := connect(t, addr, "black", "")
+	game := startGame(t, white, black, "5", "60", "0", "W")
+
+	white.SendCommand(game, "P A1")
+	expect(t, black, game+" P A1")
+	white.SendCommand(game, "RequestUndo")
+	expect(t, black, game+" RequestUndo")
+	black.SendCommand(game, "RequestUndo")
+	expect(t, white, game+" Undo")
+	expect(t, black, game+" Undo")
+	white.SendCommand(game, "P B1")
+	expect(t, black, game+" P B1")
+}
+
+func TestTimeout(t *testing.T) {
+	addr := startServer(t, &Server{})
+	white := connect(t, addr, "white", "")
+	black := connect(t, addr, "black", "")
+	game := startGame(t, white, black, "5", "1", "0", "W")
+	if over := expect(t, black, game+" Over"); over != game+" Over 0-1" {
+		t.Fatalf("result %q", over)
+	}
+}
+
+func TestAbandon(t *testing.T) {
+	addr := startServer(t, &Server{})
+	white := connect(t, addr, "white", "")
+	black := &playtak.Client{}
+	if e := black.Connect(addr); e != nil {
+		t.Fatal(e)
+	}
+	if e := black.Login("black", ""); e != nil {
+		t.Fatal(e)
+	}
+	game := startGame(t, white, black, "5", "60", "0", "W")
+	disconnect(black)
+	expect(t, white, game+" Abandoned.")
+}
+
+// scriptBot plays the moves of a PTN game for its color.
+type scriptBot struct {
+	g     *bot.Game
+	moves []tak.Move
+}
+
+func (b *scriptBot) NewGame(g *bot.Game)        { b.g = g }
+func (b *scriptBot) GameOver()                  {}
+func (b *scriptBot) AcceptUndo() bool           { return false }
+func (b *scriptBot) HandleChat(who, msg string) {}
+
+func (b *scriptBot) GetMove(ctx context.Context, p *tak.Position, mine, theirs time.Duration) tak.Move {
+	if p.ToMove() != b.g.Color {
+		<-ctx.Done()
+		return tak.Move{}
+	}
+	return b.moves[p.MoveNumber()]
+}
+
+func TestPlayGame(t *testing.T) {
+	addr := startServer(t, &Server{})
+	white := connect(t, addr, "white", "")
+	black := connect(t, addr, "black", "")
+	var moves []tak.Move
+	for _, s := range strings.Fields("a1 e5 e4 a2 e3 a3 e2 a4 e1") {
+		m, e := ptn.ParseMove(s)
+		if e != nil {
+			t.Fatal(e)
+		}
+		moves = append(moves, m)
+	}
+
+	white.SendCommand("Seek", "5", "60", "0", "W")
+	id := strings.Fields(expect(t, black, "Seek new"))[2]
+	black.SendCommand("Accept", id)
+	bots := []*scriptBot{{moves: moves}, {moves: moves}}
+	// expect may not fail the test from another goroutine, so
+	// both players see the game start here
+	starts := []string{expect(t, white, "Game Start"), expect(t, black, "Game Start")}
+	done := make(chan struct{})
+	for i, c := range []*playtak.Client{white, black} {
+		go func(c *playtak.Client, b *scriptBot, start string) {
+			bot.PlayGame(c, b, start)
+			done <- struct{}{}
+		}(c, bots[i], starts[i])
+	}
+	<-done
+	<-done
+	for _, b := range bots {
+		if over, winner := b.g.History.GameOver(); !over || winner != tak.White {
+			t.Fatalf("%s: over=%v winner=%s", b.g.Color, over, winner)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package ptn
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"../tak"
+)
+
+// A Quality is a judgement of a move, written after it as one of
+// `!`, `?`, `!!`, `??`, `!?` or `?!`.
+type Quality byte
+
+const (
+	NoQuality Quality = iota
+	Good
+	Bad
+	Excellent
+	Blunder
+	Interesting
+	Dubious
+)
+
+var qualityMarks = [...]string{"", "!", "?", "!!", "??", "!?", "?!"}
+
+func (q Quality) String() string {
+	if int(q) < len(qualityMarks) {
+		return qualityMarks[q]
+	}
+	return "?"
+}
+
+// An Annotation is the meaning of the marks written after a move:
+// `*` when a capstone flattens a wall, an apostrophe for tak and two
+// of them (or `"`) for tinuë, and a Quality.
+type Annotation struct {
+	Flatten bool
+	Tak     bool
+	Tinue   bool
+	Quality Quality
+}
+
+// ParseAnnotation parses the marks after a move. A flattening mark
+// must come first; tak marks and a quality may follow in either
+// order.
+func ParseAnnotation(s string) (Annotation, error) {
+	var a Annotation
+	if strings.HasPrefix(s, "*") {
+		a.Flatten = true
+		s = s[1:]
+	}
+	marks := strings.TrimLeft(s, "?!")
+	quality := s[:len(s)-len(marks)]
+	if quality == "" {
+		quality = strings.TrimLeft(marks, "'\"")
+		marks = marks[:len(marks)-len(quality)]
+	} else if strings.ContainsAny(marks, "?!") {
+		return Annotation{}, fmt.Errorf("bad annotation: %q", s)
+	}
+	switch marks {
+	case "":
+	case "'":
+		a.Tak = true
+	case "''", "\"":
+		a.Tinue = true
+	default:
+		return Annotation{}, fmt.Errorf("bad annotation: %q", s)
+	}
+	for q, mark := range qualityMarks {
+		if quality == mark {
+			a.Quality = Quality(q)
+			return a, nil
+		}
+	}
+	return Annotation{}, fmt.Errorf("bad annotation: %q", s)
+}
+
+// FormatAnnotation renders `a` as the marks written after a move.
+func FormatAnnotation(a Annotation) string {
+	var out string
+	if a.Flatten {
+		out = "*"
+	}
+	switch {
+	case a.Tinue:
+		out += "''"
+	case a.Tak:
+		out += "'"
+	}
+	return out + a.Quality.String()
+}
+
+// Annotation returns the meaning of the marks after `m`, or the zero
+// Annotation if they do not parse.
+func (m *Move) Annotation() Annotation {
+	a, _ := ParseAnnotation(m.Modifiers)
+	return a
+}
+
+// A MoveOption asks AddMoves or Render to do more than write the
+// moves as they are.
+type MoveOption int
+
+const (
+	// MarkMoves replays the game, including its variations, and
+	// marks each move that leaves the opponent in tinuë with two
+	// apostrophes, each other move that threatens a road with
+	// one, and each capstone flattening a wall with `*`, replacing
+	// any such marks already present; quality marks are kept. A
+	// move that ends the game is followed by the result, if it is
+	// not already. Marking stops at an illegal move.
+	MarkMoves MoveOption = iota + 1
+	// NoResults stops MarkMoves from adding results, for games
+	// whose result the moves alone do not decide, such as those
+	// lost on time or scored under rules the PTN does not record.
+	NoResults
+)
+
+func hasOption(opts []MoveOption, o MoveOption) bool {
+	for _, opt := range opts {
+		if opt == o {
+			return true
+		}
+	}
+	return false
+}
+
+// markLine returns a copy of the line `ops`, played from `g`, with
+// its moves marked as described for MarkMoves, adding results only if
+// `results` is set.
+func markLine(ops []Op, g *tak.Position, results bool) []Op {
+	out := make([]Op, 0, len(ops)+1)
+	// `before` is the position before the last move, from which
+	// variations start
+	before := g
+	for i, op := range ops {
+		switch o := op.(type) {
+		case *Move:
+			next, e := g.Move(&o.Move)
+			if e != nil {
+				return append(out, ops[i:]...)
+			}
+			m := *o
+			a := m.Annotation()
+			a.Flatten = flattens(g, &m.Move)
+			a.Tinue, a.Tak = false, false
+			over, _ := next.GameOver()
+			switch {
+			case over:
+			case next.Tinue():
+				a.Tinue = true
+			case next.HasRoadThreat(g.ToMove()):
+				a.Tak = true
+			}
+			m.Modifiers = FormatAnnotation(a)
+			out = append(out, &m)
+			if over && results && !hasResult(ops[i+1:]) {
+				out = append(out, &Result{Result: FormatResult(next.WinDetails())})
+			}
+			before, g = g, next
+		case *Variation:
+			v := *o
+			v.Ops = markLine(o.Ops, before, results)
+			out = append(out, &v)
+		default:
+			out = append(out, op)
+		}
+	}
+	return out
+}
+
+// flattens reports whether `m`, a legal move in `g`, moves a
+// capstone onto a wall.
+func flattens(g *tak.Position, m *tak.Move) bool {
+	switch m.Type {
+	case tak.SlideLeft, tak.SlideRight, tak.SlideUp, tak.SlideDown:
+		x, y := m.Dest()
+		return g.Top(x, y).Kind() == tak.Standing
+	}
+	return false
+}
+
+// hasResult reports whether `ops` hold a result before any move.
+func hasResult(ops []Op) bool {
+	for _, op := range ops {
+		switch op.(type) {
+		case *Result:
+			return true
+		case *Move:
+			return false
+		}
+	}
+	return false
+}
+
+// An Eval is an engine's analysis of the position in which a move is
+// played, recorded in a comment after the move as
+//
+//	{eval +120 depth 5 pv c3 d3 c2}
+//
+// Value is from the point of view of the player making the move, and
+// PV is the line the engine preferred, which need not begin with the
+// move played. A zero Depth and an empty PV are left out.
+type Eval struct {
+	Value int64
+	Depth int
+	PV    []tak.Move
+}
+
+// FormatEval renders `e` as the text of an eval comment.
+func FormatEval(e *Eval) string {
+	out := fmt.Sprintf("eval %+d", e.Value)
+	if e.Depth != 0 {
+		out += fmt.Sprintf(" depth %d", e.Depth)
+	}
+	if len(e.PV) > 0 {
+		out += " pv"
+		for i := range e.PV {
+			out += " " + FormatMove(&e.PV[i])
+		}
+	}
+	return out
+}
+
+// ParseEval parses the text of an eval comment, as written by
+// FormatEval.
+func ParseEval(s string) (*Eval, error) {
+	words := strings.Fields(s)
+	if len(words) < 2 || words[0] != "eval" {
+		return nil, errors.New("not an eval comment")
+	}
+	var e Eval
+	var err error
+	if e.Value, err = strconv.ParseInt(words[1], 10, 64); err != nil {
+		return nil, fmt.Errorf("bad eval: %s", words[1])
+	}
+	words = words[2:]
+	if len(words) >= 2 && words[0] == "depth" {
+		if e.Depth, err = strconv.Atoi(words[1]); err != nil {
+			return nil, fmt.Errorf("bad depth: %s", words[1])
+		}
+		words = words[2:]
+	}
+	if len(words) > 0 {
+		if words[0] != "pv" {
+			return nil, fmt.Errorf("bad eval comment: %s", s)
+		}
+		for _, w := range words[1:] {
+			m, err := ParseMove(w)
+			if err != nil {
+				return nil, fmt.Errorf("bad pv move: %s", w)
+			}
+			e.PV = append(e.PV, m)
+		}
+	}
+	return &e, nil
+}
+
+// Eval parses `c` as an eval comment.
+func (c *Comment) Eval() (*Eval, error) {
+	return ParseEval(c.Comment)
+}
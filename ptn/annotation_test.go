@@ -0,0 +1,187 @@
+package ptn
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"../tak"
+)
+
+func TestParseAnnotation(t *testing.T) {
+	cases := []struct {
+		in   string
+		want Annotation
+		out  string
+	}{
+		{"", Annotation{}, ""},
+		{"'", Annotation{Tak: true}, "'"},
+		{"''", Annotation{Tinue: true}, "''"},
+		{"\"", Annotation{Tinue: true}, "''"},
+		{"*", Annotation{Flatten: true}, "*"},
+		{"!", Annotation{Quality: Good}, "!"},
+		{"??", Annotation{Quality: Blunder}, "??"},
+		{"!?", Annotation{Quality: Interesting}, "!?"},
+		{"?!", Annotation{Quality: Dubious}, "?!"},
+		{"*''!!", Annotation{Flatten: true, Tinue: true, Quality: Excellent}, "*''!!"},
+		{"''!", Annotation{Tinue: true, Quality: Good}, "''!"},
+		{"?'", Annotation{Tak: true, Quality: Bad}, "'?"},
+	}
+	for _, tc := range cases {
+		got, e := ParseAnnotation(tc.in)
+		if e != nil {
+			t.Errorf("ParseAnnotation(%q): %v", tc.in, e)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseAnnotation(%q)=%+v want %+v", tc.in, got, tc.want)
+		}
+		if out := FormatAnnotation(got); out != tc.out {
+			t.Errorf("FormatAnnotation(%q)=%q want %q", tc.in, out, tc.out)
+		}
+	}
+	for _, bad := range []string{"'''", "!!!", "'!'", "!'?", "'*", "x"} {
+		if a, e := ParseAnnotation(bad); e == nil {
+			t.Errorf("ParseAnnotation(%q)=%+v", bad, a)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	pv := []tak.Move{
+		{X: 2, Y: 2, Type: tak.PlaceFlat},
+		{X: 2, Y: 2, Type: tak.SlideUp, Slides: []byte{1}},
+	}
+	cases := []struct {
+		e   Eval
+		out string
+	}{
+		{Eval{Value: 120, Depth: 5, PV: pv}, "eval +120 depth 5 pv c3 c3+"},
+		{Eval{Value: -7}, "eval -7"},
+		{Eval{Value: 0, PV: pv[:1]}, "eval +0 pv c3"},
+	}
+	for _, tc := range cases {
+		out := FormatEval(&tc.e)
+		if out != tc.out {
+			t.Errorf("FormatEval(%+v)=%q want %q", tc.e, out, tc.out)
+		}
+		back, e := ParseEval(out)
+		if e != nil {
+			t.Errorf("ParseEval(%q): %v", out, e)
+			continue
+		}
+		if !reflect.DeepEqual(*back, tc.e) {
+			t.Errorf("ParseEval(%q)=%+v want %+v", out, *back, tc.e)
+		}
+	}
+	for _, bad := range []string{"", "what a nub", "eval x", "eval 3 depth", "eval 3 pv zz"} {
+		if e, err := ParseEval(bad); err == nil {
+			t.Errorf("ParseEval(%q)=%+v", bad, e)
+		}
+	}
+}
+
+func TestAnnotatedPTN(t *testing.T) {
+	src := `[Size "5"]
+
+1. a1 e1
+2. c3'? {eval -40 depth 3 pv d3} Cd3*!
+`
+	p, e := ParsePTN(bytes.NewBufferString(src))
+	if e != nil {
+		t.Fatal("parse:", e)
+	}
+	m := p.Ops[4].(*Move)
+	if a := m.Annotation(); a != (Annotation{Tak: true, Quality: Bad}) {
+		t.Errorf("annotation=%+v", a)
+	}
+	ev, e := p.Ops[5].(*Comment).Eval()
+	if e != nil || ev.Value != -40 || ev.Depth != 3 || len(ev.PV) != 1 {
+		t.Errorf("eval=%+v, %v", ev, e)
+	}
+	m = p.Ops[6].(*Move)
+	if a := m.Annotation(); a != (Annotation{Flatten: true, Quality: Good}) {
+		t.Errorf("annotation=%+v", a)
+	}
+
+	if _, e := ParsePTN(bytes.NewBufferString(`[Size "5"]` + "\n\n1. a1!!! e1")); e == nil {
+		t.Error("parsed a bad annotation")
+	}
+}
+
+func TestMarkMoves(t *testing.T) {
+	src := `[Size "5"]
+
+1. a5 e1
+2. a1' a4
+3. b1 a3
+4. c1 a2?
+5. d1
+`
+	p, e := ParsePTN(bytes.NewBufferString(src))
+	if e != nil {
+		t.Fatal("parse:", e)
+	}
+	out := p.Render(MarkMoves)
+	for _, w := range []string{"2. a1 a4\n", "4. c1' a2?\n", "5. d1\nR-0\n"} {
+		if !strings.Contains(out, w) {
+			t.Errorf("render missing %q:\n%s", w, out)
+		}
+	}
+	if m := p.Ops[4].(*Move); m.Modifiers != "'" {
+		t.Errorf("Render modified the game: %q", m.Modifiers)
+	}
+
+	var moves []tak.Move
+	for _, o := range p.Ops {
+		if m, ok := o.(*Move); ok {
+			moves = append(moves, m.Move)
+		}
+	}
+	added := &PTN{Tags: []Tag{{"Size", "5"}}}
+	added.AddMoves(moves, MarkMoves)
+	// the same marks, without the quality mark from the source
+	want := strings.Replace(out, "a2?", "a2", 1)
+	if got := added.Render(); got != want {
+		t.Errorf("AddMoves marked:\n%s\nwant:\n%s", got, want)
+	}
+	added = &PTN{Tags: []Tag{{"Size", "5"}}}
+	added.AddMoves(moves, MarkMoves, NoResults)
+	if n := len(added.Ops); n != len(p.Ops) {
+		t.Errorf("NoResults: %d ops want %d", n, len(p.Ops))
+	}
+	if got := p.Render(MarkMoves, NoResults); strings.Contains(got, "R-0") {
+		t.Errorf("NoResults added a result:\n%s", got)
+	}
+
+	src = `[Size "5"]
+[TPS "2,2,x3/x5/x,1,1,1,x/x5/x,1,1,1,1 1 6"]
+
+6. e3 (6. c5) a1 7. a3
+`
+	p, e = ParsePTN(bytes.NewBufferString(src))
+	if e != nil {
+		t.Fatal("parse:", e)
+	}
+	out = p.Render(MarkMoves)
+	for _, w := range []string{"6. e3'' (6. c5') a1", "7. a3\nR-0"} {
+		if !strings.Contains(out, w) {
+			t.Errorf("render missing %q:\n%s", w, out)
+		}
+	}
+
+	src = `[Size "5"]
+[TPS "2S,x4/1C,x4/x5/x5/x5 1 5"]
+
+5. a4+* b1 6. a3! 0-1
+`
+	p, e = ParsePTN(bytes.NewBufferString(src))
+	if e != nil {
+		t.Fatal("parse:", e)
+	}
+	out = p.Render(MarkMoves)
+	if w := "5. a4+* b1\n6. a3!\n0-1\n"; !strings.Contains(out, w) {
+		t.Errorf("render missing %q:\n%s", w, out)
+	}
+}
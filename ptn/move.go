@@ -3,6 +3,7 @@ package ptn
 import (
 	"errors"
 	"regexp"
+	"strings"
 
 	"../tak"
 )
@@ -125,3 +126,18 @@ func FormatMove(m *tak.Move) string {
 	}
 	return string(out)
 }
+
+// FormatSquare renders a square in PTN notation, e.g. "c3".
+func FormatSquare(c tak.Coord) string {
+	return string([]byte{byte('a' + c.X), byte('1' + c.Y)})
+}
+
+// FormatRoad renders the path of a road as a list of squares,
+// e.g. "a1 b1 b2 c2 d2".
+func FormatRoad(r *tak.Road) string {
+	out := make([]string, len(r.Path))
+	for i, c := range r.Path {
+		out[i] = FormatSquare(c)
+	}
+	return strings.Join(out, " ")
+}
@@ -88,6 +88,15 @@ func TestParseMoveErrors(t *testing.T) {
 	}
 }
 
+func TestFormatRoad(t *testing.T) {
+	r := &tak.Road{Path: []tak.Coord{
+		{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}, {X: 2, Y: 1}, {X: 2, Y: 2},
+	}}
+	if got := FormatRoad(r); got != "a1 b1 b2 c2 c3" {
+		t.Errorf("FormatRoad=%q", got)
+	}
+}
+
 func BenchmarkParseMove(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		ParseMove("3a1+111")
@@ -44,11 +44,16 @@ func (o *opCommon) clearSrc() {
 type MoveNumber struct {
 	opCommon
 	Number int
+	// Continuation is set for a `N...` marker, which resumes
+	// move N at black's turn, as at the start of a variation.
+	Continuation bool
 }
 
 type Move struct {
 	opCommon
-	Move      tak.Move
+	Move tak.Move
+	// Modifiers are the marks written after the move, which
+	// Annotation interprets.
 	Modifiers string
 }
 
@@ -57,6 +62,21 @@ type Comment struct {
 	Comment string
 }
 
+// A Variation is an alternative line, written in parentheses after
+// the move it replaces. Its Ops continue from the position before
+// that move and may hold further variations.
+type Variation struct {
+	opCommon
+	Ops []Op
+}
+
+func (v *Variation) clearSrc() {
+	v.src = ""
+	for _, o := range v.Ops {
+		o.clearSrc()
+	}
+}
+
 type Result struct {
 	opCommon
 	Result string
@@ -74,9 +94,30 @@ func (r *Result) Winner() tak.Color {
 	return tak.NoColor
 }
 
+// FormatResult returns the result of a game that ended as `d`
+// describes, as written in a Result tag.
+func FormatResult(d tak.WinDetails) string {
+	win := "F"
+	switch d.Reason {
+	case tak.RoadWin:
+		win = "R"
+	case tak.Resignation:
+		win = "1"
+	}
+	switch d.Winner {
+	case tak.White:
+		return win + "-0"
+	case tak.Black:
+		return "0-" + win
+	}
+	return "1/2-1/2"
+}
+
 type PTN struct {
 	Tags []Tag
-	Ops  []Op
+	// Ops is the main line of the game. Variations within it hold
+	// the alternative lines.
+	Ops []Op
 }
 
 func ParsePTN(r io.Reader) (*PTN, error) {
@@ -107,20 +148,77 @@ func (p *PTN) FindTag(name string) string {
 	return ""
 }
 
+// Config returns the rules of the game, from the Size, Komi,
+// reserve and CapFlatten tags. `Flats` and `Caps` set both sides'
+// reserves, and `Flats1`, `Caps1`, `Flats2` and `Caps2` set those of
+// player 1 (white) and player 2 (black).
+func (p *PTN) Config() (tak.Config, error) {
+	size, e := p.Size()
+	if e != nil {
+		return tak.Config{}, e
+	}
+	cfg := tak.Config{Size: size}
+	if cfg.HalfKomi, e = p.Komi(); e != nil {
+		return tak.Config{}, e
+	}
+	if cfg.Reserves, e = p.Reserves(); e != nil {
+		return tak.Config{}, e
+	}
+	flatten, e := p.CapFlatten()
+	if e != nil {
+		return tak.Config{}, e
+	}
+	cfg.NoCapstoneFlatten = !flatten
+	return cfg, nil
+}
+
+// ConfigTags returns the tags describing the rules in `cfg`, the
+// inverse of Config. Rules at their default are omitted.
+func ConfigTags(cfg tak.Config) []Tag {
+	tags := []Tag{{Name: "Size", Value: strconv.Itoa(cfg.Size)}}
+	if cfg.HalfKomi != 0 {
+		tags = append(tags, Tag{Name: "Komi", Value: FormatKomi(cfg.HalfKomi)})
+	}
+	tags = append(tags, formatReserves(&cfg)...)
+	if cfg.NoCapstoneFlatten {
+		tags = append(tags, Tag{Name: "CapFlatten", Value: "false"})
+	}
+	return tags
+}
+
+// formatReserves returns the reserve tags for `cfg`, if its reserves
+// are not the standard ones.
+func formatReserves(cfg *tak.Config) []Tag {
+	r := cfg.StartingReserves()
+	if r == tak.DefaultReserves(cfg.Size) {
+		return nil
+	}
+	if r.WhiteStones == r.BlackStones && r.WhiteCaps == r.BlackCaps {
+		return []Tag{
+			{Name: "Flats", Value: strconv.Itoa(r.WhiteStones)},
+			{Name: "Caps", Value: strconv.Itoa(r.WhiteCaps)}}
+	}
+	return []Tag{
+		{Name: "Flats1", Value: strconv.Itoa(r.WhiteStones)},
+		{Name: "Caps1", Value: strconv.Itoa(r.WhiteCaps)},
+		{Name: "Flats2", Value: strconv.Itoa(r.BlackStones)},
+		{Name: "Caps2", Value: strconv.Itoa(r.BlackCaps)}}
+}
+
 func (p *PTN) InitialPosition() (*tak.Position, error) {
-	sizeTag := p.FindTag("Size")
-	size, e := strconv.Atoi(sizeTag)
+	cfg, e := p.Config()
 	if e != nil {
-		return nil, fmt.Errorf("bad size: %s", sizeTag)
+		return nil, e
 	}
+	size := cfg.Size
 	tps := p.FindTag("TPS")
 	var out *tak.Position
 	if tps == "" {
-		out = tak.New(tak.Config{Size: size})
+		out = tak.New(cfg)
 	} else {
-		out, e = ParseTPS(tps)
+		out, e = ParseTPSConfig(tps, cfg)
 		if e != nil {
-			return nil, fmt.Errorf("bad TPS: %v", e)
+			return nil, e
 		}
 		if out.Size() != size {
 			return nil, fmt.Errorf("size mismatch: tag %d != TPS %d",
@@ -130,21 +228,48 @@ func (p *PTN) InitialPosition() (*tak.Position, error) {
 	return out, nil
 }
 
+// ParseKomi parses the value of a PTN `Komi` tag (e.g. "2" or
+// "2.5") into half-flats, as used by tak.Config.HalfKomi.
+func ParseKomi(komi string) (int, error) {
+	f, e := strconv.ParseFloat(komi, 64)
+	if e != nil || f < 0 || f*2 != float64(int(f*2)) {
+		return 0, fmt.Errorf("bad komi: %s", komi)
+	}
+	return int(f * 2), nil
+}
+
+// FormatKomi renders a komi in half-flats in PTN tag syntax.
+func FormatKomi(halfKomi int) string {
+	if halfKomi%2 == 0 {
+		return strconv.Itoa(halfKomi / 2)
+	}
+	return fmt.Sprintf("%d.5", halfKomi/2)
+}
+
 // PositionAtMove returns the position of the game after PTN move
 // marker `move`, with `color` to play.
 //
 // `move=0` will cause the code to return the final position of the
 // game.
-func (p *PTN) PositionAtMove(move int, color tak.Color) (*tak.Position, error) {
+//
+// `path`, if given, follows variations instead of the main line:
+// each element selects a variation, counting from 0, among those in
+// the line reached so far, and `move` is then looked up in the last
+// variation's line.
+func (p *PTN) PositionAtMove(move int, color tak.Color, path ...int) (*tak.Position, error) {
 	if color == tak.NoColor && move != 0 {
 		return nil, fmt.Errorf("can't specify NoColor and move!=0")
 	}
+	ops, e := p.Line(path...)
+	if e != nil {
+		return nil, e
+	}
 	g, e := p.InitialPosition()
 	if e != nil {
 		return nil, e
 	}
 	var ptnMove int
-	for _, op := range p.Ops {
+	for _, op := range ops {
 		switch o := op.(type) {
 		case *MoveNumber:
 			ptnMove = o.Number
@@ -166,6 +291,48 @@ func (p *PTN) PositionAtMove(move int, color tak.Color) (*tak.Position, error) {
 	return g, nil
 }
 
+// Line returns the ops of the line of play reached by following
+// `path` from the main line, as described for PositionAtMove: the
+// ops leading up to each variation followed by those of the
+// variation. Variations along the way are left out.
+func (p *PTN) Line(path ...int) ([]Op, error) {
+	var out []Op
+	ops := p.Ops
+	for depth, n := range path {
+		var v *Variation
+		last := -1
+		for i, op := range ops {
+			switch o := op.(type) {
+			case *Move:
+				last = i
+			case *Variation:
+				if n == 0 {
+					v = o
+				}
+				n--
+			}
+			if v != nil {
+				break
+			}
+		}
+		if v == nil || last < 0 {
+			return nil, fmt.Errorf("variation not found: %v", path[:depth+1])
+		}
+		out = appendLine(out, ops[:last])
+		ops = v.Ops
+	}
+	return appendLine(out, ops), nil
+}
+
+func appendLine(out []Op, ops []Op) []Op {
+	for _, op := range ops {
+		if _, ok := op.(*Variation); !ok {
+			out = append(out, op)
+		}
+	}
+	return out
+}
+
 func readEvents(r *bufio.Reader, ptn *PTN) error {
 	for {
 		if e := skipWS(r); e != nil {
@@ -200,30 +367,71 @@ var resultRE = regexp.MustCompile(`^(F|R|1/2|1|0)-(F|R|1/2|1|0)$`)
 func readMoves(r *bufio.Reader, ptn *PTN) error {
 	s := bufio.NewScanner(r)
 	s.Split(splitMoves)
+	// `line` is the line being read, and `outer` the lines
+	// enclosing it
+	line := &ptn.Ops
+	var outer []*[]Op
 	for s.Scan() {
 		tok := s.Text()
 		common := opCommon{tok}
 		switch {
+		case tok == "(":
+			if !hasMove(*line) {
+				return errors.New("variation before any move")
+			}
+			v := &Variation{opCommon: common}
+			*line = append(*line, v)
+			outer = append(outer, line)
+			line = &v.Ops
+		case tok == ")":
+			if len(outer) == 0 {
+				return errors.New("unbalanced )")
+			}
+			line = outer[len(outer)-1]
+			outer = outer[:len(outer)-1]
 		case tok[0] == '{':
-			ptn.Ops = append(ptn.Ops, &Comment{common, tok[1 : len(tok)-1]})
+			*line = append(*line, &Comment{common, tok[1 : len(tok)-1]})
 		case tok[len(tok)-1] == '.':
-			n, e := strconv.Atoi(tok[:len(tok)-1])
+			num := strings.TrimSuffix(tok, "...")
+			cont := len(num) < len(tok)
+			if !cont {
+				num = tok[:len(tok)-1]
+			}
+			n, e := strconv.Atoi(num)
 			if e != nil {
 				return e
 			}
-			ptn.Ops = append(ptn.Ops, &MoveNumber{common, n})
+			*line = append(*line, &MoveNumber{common, n, cont})
 		case resultRE.MatchString(tok):
-			ptn.Ops = append(ptn.Ops, &Result{common, tok})
+			*line = append(*line, &Result{common, tok})
 		default:
-			trimmed := strings.TrimRight(tok, "?!'")
+			trimmed := strings.TrimRight(tok, "?!'\"*")
 			move, e := ParseMove(trimmed)
 			if e != nil {
 				return fmt.Errorf("bad move: %s", trimmed)
 			}
-			ptn.Ops = append(ptn.Ops, &Move{common, move, tok[len(trimmed):]})
+			if _, e := ParseAnnotation(tok[len(trimmed):]); e != nil {
+				return e
+			}
+			*line = append(*line, &Move{common, move, tok[len(trimmed):]})
+		}
+	}
+	if e := s.Err(); e != nil {
+		return e
+	}
+	if len(outer) != 0 {
+		return errors.New("unterminated variation")
+	}
+	return nil
+}
+
+func hasMove(ops []Op) bool {
+	for _, op := range ops {
+		if _, ok := op.(*Move); ok {
+			return true
 		}
 	}
-	return s.Err()
+	return false
 }
 
 func splitMoves(buf []byte, atEOF bool) (int, []byte, error) {
@@ -234,16 +442,22 @@ func splitMoves(buf []byte, atEOF bool) (int, []byte, error) {
 	if start == len(buf) {
 		return start, nil, nil
 	}
-	if buf[start] == '{' {
+	switch buf[start] {
+	case '{':
 		for i := start; i < len(buf); i++ {
 			if buf[i] == '}' {
 				return i + 1, buf[start : i+1], nil
 			}
 		}
-	} else {
+	case '(', ')':
+		return start + 1, buf[start : start+1], nil
+	default:
 		for i := start; i < len(buf); i++ {
-			if unicode.IsSpace(rune(buf[i])) {
+			switch {
+			case unicode.IsSpace(rune(buf[i])):
 				return i + 1, buf[start:i], nil
+			case buf[i] == '(' || buf[i] == ')' || buf[i] == '{':
+				return i, buf[start:i], nil
 			}
 		}
 	}
@@ -265,7 +479,14 @@ func skipWS(r *bufio.Reader) error {
 	}
 }
 
-func (p *PTN) Render() string {
+// Render writes `p` in PTN, as modified by `opts`.
+func (p *PTN) Render(opts ...MoveOption) string {
+	ops := p.Ops
+	if hasOption(opts, MarkMoves) {
+		if g, e := p.InitialPosition(); e == nil {
+			ops = markLine(ops, g, !hasOption(opts, NoResults))
+		}
+	}
 	var out bytes.Buffer
 	for _, tag := range p.Tags {
 		fmt.Fprintf(&out, "[%s \"%s\"]\n",
@@ -274,28 +495,67 @@ func (p *PTN) Render() string {
 	}
 	out.WriteString("\n")
 
-	for _, op := range p.Ops {
+	for _, op := range ops {
 		switch o := op.(type) {
 		case *MoveNumber:
-			fmt.Fprintf(&out, "\n%d.", o.Number)
-		case *Move:
-			fmt.Fprintf(&out, " %s%s", FormatMove(&o.Move), o.Modifiers)
-		case *Comment:
-			fmt.Fprintf(&out, " {%s}", o.Comment)
+			fmt.Fprintf(&out, "\n%s", formatMoveNumber(o))
 		case *Result:
 			fmt.Fprintf(&out, "\n%s\n", o.Result)
 		default:
+			out.WriteString(" ")
+			renderOp(&out, op)
 		}
 	}
 	out.WriteString("\n")
 	return out.String()
 }
 
-func (p *PTN) AddMoves(moves []tak.Move) {
+// renderOp renders `op` as it appears within a line, with
+// variations on a single line.
+func renderOp(out *bytes.Buffer, op Op) {
+	switch o := op.(type) {
+	case *MoveNumber:
+		out.WriteString(formatMoveNumber(o))
+	case *Move:
+		fmt.Fprintf(out, "%s%s", FormatMove(&o.Move), o.Modifiers)
+	case *Comment:
+		fmt.Fprintf(out, "{%s}", o.Comment)
+	case *Result:
+		out.WriteString(o.Result)
+	case *Variation:
+		out.WriteString("(")
+		for i, op := range o.Ops {
+			if i > 0 {
+				out.WriteString(" ")
+			}
+			renderOp(out, op)
+		}
+		out.WriteString(")")
+	}
+}
+
+func formatMoveNumber(n *MoveNumber) string {
+	if n.Continuation {
+		return fmt.Sprintf("%d...", n.Number)
+	}
+	return fmt.Sprintf("%d.", n.Number)
+}
+
+// AddMoves appends `moves` to the main line, as modified by `opts`.
+func (p *PTN) AddMoves(moves []tak.Move, opts ...MoveOption) {
+	var g *tak.Position
+	if hasOption(opts, MarkMoves) {
+		g, _ = p.PositionAtMove(0, tak.NoColor)
+	}
+	start := len(p.Ops)
 	for i, m := range moves {
 		if i%2 == 0 {
 			p.Ops = append(p.Ops, &MoveNumber{Number: i/2 + 1})
 		}
 		p.Ops = append(p.Ops, &Move{Move: m})
 	}
+	if g != nil {
+		p.Ops = append(p.Ops[:start],
+			markLine(p.Ops[start:], g, !hasOption(opts, NoResults))...)
+	}
 }
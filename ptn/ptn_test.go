@@ -214,3 +214,199 @@ func TestPositionAtMove(t *testing.T) {
 	}
 
 }
+
+func TestKomi(t *testing.T) {
+	cases := []struct {
+		in   string
+		half int
+		ok   bool
+	}{
+		{"0", 0, true},
+		{"2", 4, true},
+		{"2.5", 5, true},
+		{"0.5", 1, true},
+		{"1.25", 0, false},
+		{"-1", 0, false},
+		{"two", 0, false},
+	}
+	for _, tc := range cases {
+		half, e := ParseKomi(tc.in)
+		if (e == nil) != tc.ok {
+			t.Errorf("ParseKomi(%q): err=%v", tc.in, e)
+			continue
+		}
+		if !tc.ok {
+			continue
+		}
+		if half != tc.half {
+			t.Errorf("ParseKomi(%q)=%d want %d", tc.in, half, tc.half)
+		}
+		if back := FormatKomi(half); back != tc.in {
+			t.Errorf("FormatKomi(%d)=%q want %q", half, back, tc.in)
+		}
+	}
+
+	p, e := ParsePTN(bytes.NewBufferString(`[Size "6"]
+[Komi "2.5"]
+[TPS "x6/x6/x6/x6/x6/x6 1 1"]
+`))
+	if e != nil {
+		t.Fatal("parse:", e)
+	}
+	pos, e := p.InitialPosition()
+	if e != nil {
+		t.Fatal("initial:", e)
+	}
+	if pos.HalfKomi() != 5 {
+		t.Fatalf("komi=%d", pos.HalfKomi())
+	}
+}
+
+func TestConfigTags(t *testing.T) {
+	cases := []struct {
+		cfg  tak.Config
+		tags []Tag
+	}{
+		{tak.Config{Size: 5}, []Tag{{"Size", "5"}}},
+		{tak.Config{Size: 6, HalfKomi: 4}, []Tag{{"Size", "6"}, {"Komi", "2"}}},
+		{
+			tak.Config{Size: 5, Reserves: tak.ReservesFor(5, -1, 0)},
+			[]Tag{{"Size", "5"}, {"Flats", "21"}, {"Caps", "0"}},
+		},
+		{
+			tak.Config{Size: 4, Reserves: &tak.Reserves{
+				WhiteStones: 15, WhiteCaps: 1,
+				BlackStones: 16, BlackCaps: 0,
+			}},
+			[]Tag{{"Size", "4"},
+				{"Flats1", "15"}, {"Caps1", "1"},
+				{"Flats2", "16"}, {"Caps2", "0"}},
+		},
+		{
+			tak.Config{Size: 6, HalfKomi: 1, NoCapstoneFlatten: true},
+			[]Tag{{"Size", "6"}, {"Komi", "0.5"}, {"CapFlatten", "false"}},
+		},
+	}
+	for i, tc := range cases {
+		tags := ConfigTags(tc.cfg)
+		if !reflect.DeepEqual(tags, tc.tags) {
+			t.Errorf("%d: tags=%v want %v", i, tags, tc.tags)
+			continue
+		}
+		g := &PTN{Tags: tags}
+		p, e := g.InitialPosition()
+		if e != nil {
+			t.Errorf("%d: InitialPosition: %v", i, e)
+			continue
+		}
+		want := tak.New(tc.cfg)
+		if p.WhiteStones() != want.WhiteStones() || p.WhiteCaps() != want.WhiteCaps() ||
+			p.BlackStones() != want.BlackStones() || p.BlackCaps() != want.BlackCaps() ||
+			p.HalfKomi() != want.HalfKomi() {
+			t.Errorf("%d: position does not match config", i)
+		}
+		if p.Config().NoCapstoneFlatten != tc.cfg.NoCapstoneFlatten {
+			t.Errorf("%d: NoCapstoneFlatten=%v", i, p.Config().NoCapstoneFlatten)
+		}
+	}
+
+	g := &PTN{Tags: []Tag{{"Size", "5"}, {"Flats", "100"}}}
+	if _, e := g.InitialPosition(); e == nil {
+		t.Errorf("accepted impossible reserves")
+	}
+	g = &PTN{Tags: []Tag{{"Size", "5"}, {"CapFlatten", "maybe"}}}
+	if _, e := g.InitialPosition(); e == nil {
+		t.Errorf("accepted bad CapFlatten")
+	}
+}
+
+const variationGame = `[Size "5"]
+
+1. a1 e1
+2. c3 (2. b3 {also fine} c3 (2... d3 3. c2) 3. d2) (2. Cc3) b3
+3. c2 {main} 3... d3
+`
+
+func TestVariations(t *testing.T) {
+	p, e := ParsePTN(bytes.NewBufferString(variationGame))
+	if e != nil {
+		t.Fatal("parse:", e)
+	}
+	var main []string
+	var vars []*Variation
+	for _, o := range p.Ops {
+		switch o := o.(type) {
+		case *Move:
+			main = append(main, FormatMove(&o.Move))
+		case *Variation:
+			vars = append(vars, o)
+		}
+	}
+	if want := []string{"a1", "e1", "c3", "b3", "c2", "d3"}; !reflect.DeepEqual(main, want) {
+		t.Fatalf("main line=%v want %v", main, want)
+	}
+	if len(vars) != 2 || len(vars[0].Ops) != 7 || len(vars[1].Ops) != 2 {
+		t.Fatalf("variations=%#v", vars)
+	}
+	last := p.Ops[len(p.Ops)-2].(*MoveNumber)
+	if !last.Continuation || last.Number != 3 {
+		t.Errorf("continuation=%#v", last)
+	}
+
+	cases := []struct {
+		path  []int
+		move  int
+		color tak.Color
+		tps   string
+	}{
+		{nil, 0, tak.NoColor, "x5/x5/x,2,1,2,x/x2,1,x2/2,x3,1 1 4"},
+		{[]int{0}, 0, tak.NoColor, "x5/x5/x,1,2,x2/x3,1,x/2,x3,1 2 3"},
+		{[]int{0}, 2, tak.Black, "x5/x5/x,1,x3/x5/2,x3,1 2 2"},
+		{[]int{1}, 0, tak.NoColor, "x5/x5/x2,1C,x2/x5/2,x3,1 2 2"},
+		{[]int{0, 0}, 0, tak.NoColor, "x5/x5/x,1,x,2,x/x2,1,x2/2,x3,1 2 3"},
+		{[]int{0, 0}, 3, tak.White, "x5/x5/x,1,x,2,x/x5/2,x3,1 1 3"},
+	}
+	for _, tc := range cases {
+		pos, e := p.PositionAtMove(tc.move, tc.color, tc.path...)
+		if e != nil {
+			t.Errorf("AtMove(%d, %s, %v): %v", tc.move, tc.color, tc.path, e)
+			continue
+		}
+		if tps := FormatTPS(pos); tps != tc.tps {
+			t.Errorf("AtMove(%d, %s, %v) =\n   %s\n!= %s",
+				tc.move, tc.color, tc.path, tps, tc.tps)
+		}
+	}
+	for _, path := range [][]int{{2}, {1, 0}, {0, 1}} {
+		if _, e := p.PositionAtMove(0, tak.NoColor, path...); e == nil {
+			t.Errorf("path %v: no error", path)
+		}
+	}
+
+	render := p.Render()
+	if !strings.Contains(render, "(2. b3 {also fine} c3 (2... d3 3. c2) 3. d2) (2. Cc3)") {
+		t.Errorf("render:\n%s", render)
+	}
+	back, e := ParsePTN(bytes.NewBufferString(render))
+	if e != nil {
+		t.Fatalf("parse rendered: %v", e)
+	}
+	for _, ops := range [][]Op{p.Ops, back.Ops} {
+		for _, o := range ops {
+			o.clearSrc()
+		}
+	}
+	if !reflect.DeepEqual(p.Ops, back.Ops) {
+		t.Fatalf("different ops! in=%#v, out=%#v", p.Ops, back.Ops)
+	}
+
+	for _, bad := range []string{
+		"1. a1 (1. b1",
+		"1. a1) e1",
+		"(1. a1) 1. b1",
+	} {
+		if _, e := ParsePTN(strings.NewReader(`[Size "5"]` + "\n\n" + bad)); e == nil {
+			t.Errorf("%q: no error", bad)
+		}
+	}
+}
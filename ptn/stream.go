@@ -0,0 +1,134 @@
+package ptn
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A GameError is returned by Reader.Next for a game that does not
+// parse. Game counts the games in the stream from 1, and Line is
+// the line on which the game starts.
+type GameError struct {
+	Game, Line int
+	Err        error
+}
+
+func (e *GameError) Error() string {
+	return fmt.Sprintf("game %d (line %d): %v", e.Game, e.Line, e.Err)
+}
+
+func (e *GameError) Unwrap() error {
+	return e.Err
+}
+
+// A Reader reads successive games from a stream of concatenated PTN
+// games. A game ends where a tag line follows the moves of the
+// previous one, or a blank line after its tags, outside of any
+// comment.
+type Reader struct {
+	r    *bufio.Reader
+	line int
+	game int
+
+	// next holds a tag line read ahead, which starts the next game
+	// on line nextLine.
+	next     string
+	nextLine int
+	err      error
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next game in the stream, or io.EOF after the
+// last one. A game that does not parse is reported as a *GameError,
+// after which Next may be called again to read the games that
+// follow it; any other error ends the stream.
+func (r *Reader) Next() (*PTN, error) {
+	text, line, e := r.readGame()
+	if text == "" {
+		return nil, e
+	}
+	r.game++
+	p, e := ParsePTN(strings.NewReader(text))
+	if e != nil {
+		return nil, &GameError{Game: r.game, Line: line, Err: e}
+	}
+	return p, nil
+}
+
+// readGame returns the text of the next game and the line it
+// starts on.
+func (r *Reader) readGame() (string, int, error) {
+	var buf strings.Builder
+	start := 0
+	if r.next != "" {
+		buf.WriteString(r.next)
+		start = r.nextLine
+		r.next = ""
+	}
+	// `body` is set once the game's tags have ended, and
+	// `comments` counts the comments open at the end of a line
+	body := false
+	comments := 0
+	for r.err == nil {
+		var line string
+		line, r.err = r.r.ReadString('\n')
+		if line == "" {
+			break
+		}
+		r.line++
+		if r.line == 1 {
+			line = strings.TrimPrefix(line, "\uFEFF")
+		}
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case comments == 0 && strings.HasPrefix(trimmed, "["):
+			if body {
+				r.next, r.nextLine = line, r.line
+				return buf.String(), start, nil
+			}
+		case buf.Len() == 0 && trimmed == "":
+			continue
+		default:
+			body = true
+			comments += strings.Count(line, "{") - strings.Count(line, "}")
+			if comments < 0 {
+				comments = 0
+			}
+		}
+		if buf.Len() == 0 {
+			start = r.line
+		}
+		buf.WriteString(line)
+	}
+	if r.err != io.EOF {
+		return "", start, r.err
+	}
+	return buf.String(), start, io.EOF
+}
+
+// A Writer writes games to a stream that a Reader can read back.
+type Writer struct {
+	w     io.Writer
+	games int
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Write appends `p` to the stream, separated from the game before
+// it by a blank line.
+func (w *Writer) Write(p *PTN) error {
+	out := p.Render()
+	if w.games > 0 {
+		out = "\n" + out
+	}
+	w.games++
+	_, e := io.WriteString(w.w, out)
+	return e
+}
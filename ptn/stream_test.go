@@ -0,0 +1,105 @@
+package ptn
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+const streamGames = "\uFEFF" + `[Size "5"]
+[Player1 "one"]
+
+1. a1 e1
+2. c3 {a comment
+[that looks like a tag]} d3
+R-0
+[Size "4"]
+[Player1 "two"]
+1. a1 d4 2. b2 zz9
+[Size "6"]
+[Player1 "three"]
+
+
+[Size "3"]
+[Player1 "four"]
+
+1. a1 c3
+`
+
+func TestReader(t *testing.T) {
+	r := NewReader(strings.NewReader(streamGames))
+	var players []string
+	var bad []*GameError
+	for {
+		p, e := r.Next()
+		if e == io.EOF {
+			break
+		}
+		var ge *GameError
+		if errors.As(e, &ge) {
+			bad = append(bad, ge)
+			continue
+		}
+		if e != nil {
+			t.Fatal("next:", e)
+		}
+		players = append(players, p.FindTag("Player1"))
+		if p.FindTag("Player1") == "one" {
+			if len(p.Ops) != 8 {
+				t.Errorf("ops=%d", len(p.Ops))
+			}
+			if c, ok := p.Ops[5].(*Comment); !ok || !strings.Contains(c.Comment, "[that") {
+				t.Errorf("comment=%#v", p.Ops[5])
+			}
+		}
+	}
+	if strings.Join(players, ",") != "one,three,four" {
+		t.Errorf("players=%v", players)
+	}
+	if len(bad) != 1 || bad[0].Game != 2 || bad[0].Line != 8 {
+		t.Fatalf("errors=%v", bad)
+	}
+	if _, e := r.Next(); e != io.EOF {
+		t.Errorf("after EOF: %v", e)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var games []*PTN
+	r := NewReader(strings.NewReader(streamGames))
+	for {
+		p, e := r.Next()
+		if e == io.EOF {
+			break
+		}
+		if e == nil {
+			games = append(games, p)
+		}
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, p := range games {
+		if e := w.Write(p); e != nil {
+			t.Fatal("write:", e)
+		}
+	}
+	r = NewReader(&buf)
+	for i := 0; ; i++ {
+		p, e := r.Next()
+		if e == io.EOF {
+			if i != len(games) {
+				t.Fatalf("read %d games, wrote %d", i, len(games))
+			}
+			break
+		}
+		if e != nil {
+			t.Fatalf("read %d: %v", i, e)
+		}
+		if got, want := p.Render(), games[i].Render(); got != want {
+			t.Errorf("game %d:\n%s\n!=\n%s", i, got, want)
+		}
+	}
+}
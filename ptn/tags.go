@@ -0,0 +1,362 @@
+package ptn
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"../tak"
+)
+
+// knownTags are the tags of the PTN specification, `Id`, which
+// playtak.com game logs add, and `CapFlatten`, which records games
+// played with capstones unable to flatten walls.
+var knownTags = map[string]bool{
+	"Site": true, "Event": true, "Round": true,
+	"Date": true, "Time": true, "Clock": true,
+	"Player1": true, "Player2": true,
+	"Rating1": true, "Rating2": true,
+	"Result": true, "Size": true, "TPS": true, "Komi": true,
+	"Flats": true, "Caps": true,
+	"Flats1": true, "Caps1": true,
+	"Flats2": true, "Caps2": true,
+	"Id": true, "CapFlatten": true,
+}
+
+var reserveTags = []string{"Flats", "Caps", "Flats1", "Caps1", "Flats2", "Caps2"}
+
+const (
+	dateFormat = "2006.01.02"
+	timeFormat = "15:04:05"
+)
+
+// SetTag sets the tag `name` to `value`, replacing the first tag of
+// that name or adding one at the end.
+func (p *PTN) SetTag(name, value string) {
+	for i := range p.Tags {
+		if p.Tags[i].Name == name {
+			p.Tags[i].Value = value
+			return
+		}
+	}
+	p.Tags = append(p.Tags, Tag{Name: name, Value: value})
+}
+
+func (p *PTN) removeTag(name string) {
+	out := p.Tags[:0]
+	for _, t := range p.Tags {
+		if t.Name != name {
+			out = append(out, t)
+		}
+	}
+	p.Tags = out
+}
+
+// Size returns the board size from the Size tag.
+func (p *PTN) Size() (int, error) {
+	v := p.FindTag("Size")
+	size, e := strconv.Atoi(v)
+	if e != nil || size < 3 || size > 8 {
+		return 0, fmt.Errorf("bad size: %s", v)
+	}
+	return size, nil
+}
+
+// Komi returns the komi from the Komi tag in half-flats, or 0 if
+// there is none.
+func (p *PTN) Komi() (int, error) {
+	v := p.FindTag("Komi")
+	if v == "" {
+		return 0, nil
+	}
+	return ParseKomi(v)
+}
+
+// Reserves returns the reserves set by the reserve tags, or nil if
+// there are none. `Flats` and `Caps` set both sides' reserves, and
+// `Flats1`, `Caps1`, `Flats2` and `Caps2` set those of player 1
+// (white) and player 2 (black); other counts are the standard ones
+// for the size.
+func (p *PTN) Reserves() (*tak.Reserves, error) {
+	custom := false
+	for _, name := range reserveTags {
+		custom = custom || p.FindTag(name) != ""
+	}
+	if !custom {
+		return nil, nil
+	}
+	size, e := p.Size()
+	if e != nil {
+		return nil, e
+	}
+	r := tak.DefaultReserves(size)
+	for _, t := range []struct {
+		name string
+		vals []*int
+	}{
+		{"Flats", []*int{&r.WhiteStones, &r.BlackStones}},
+		{"Caps", []*int{&r.WhiteCaps, &r.BlackCaps}},
+		{"Flats1", []*int{&r.WhiteStones}},
+		{"Caps1", []*int{&r.WhiteCaps}},
+		{"Flats2", []*int{&r.BlackStones}},
+		{"Caps2", []*int{&r.BlackCaps}},
+	} {
+		v := p.FindTag(t.name)
+		if v == "" {
+			continue
+		}
+		n, e := strconv.Atoi(v)
+		if e != nil {
+			return nil, fmt.Errorf("bad %s: %s", t.name, v)
+		}
+		for _, ptr := range t.vals {
+			*ptr = n
+		}
+	}
+	if !r.Valid() {
+		return nil, fmt.Errorf("bad reserves: %+v", r)
+	}
+	return &r, nil
+}
+
+// CapFlatten reports whether capstones may flatten walls, from the
+// CapFlatten tag; they may unless it is "false".
+func (p *PTN) CapFlatten() (bool, error) {
+	v := p.FindTag("CapFlatten")
+	if v == "" {
+		return true, nil
+	}
+	flatten, e := strconv.ParseBool(v)
+	if e != nil {
+		return false, fmt.Errorf("bad CapFlatten: %s", v)
+	}
+	return flatten, nil
+}
+
+// SetConfig replaces the Size, Komi, reserve and CapFlatten tags
+// with those describing `cfg`.
+func (p *PTN) SetConfig(cfg tak.Config) {
+	p.removeTag("Size")
+	p.removeTag("Komi")
+	p.removeTag("CapFlatten")
+	for _, name := range reserveTags {
+		p.removeTag(name)
+	}
+	p.Tags = append(p.Tags, ConfigTags(cfg)...)
+}
+
+// Id returns the playtak.com game number from the Id tag, or 0 if
+// there is none.
+func (p *PTN) Id() (int, error) {
+	v := p.FindTag("Id")
+	if v == "" {
+		return 0, nil
+	}
+	id, e := strconv.Atoi(v)
+	if e != nil || id <= 0 {
+		return 0, fmt.Errorf("bad Id: %s", v)
+	}
+	return id, nil
+}
+
+func (p *PTN) SetId(id int) {
+	p.SetTag("Id", strconv.Itoa(id))
+}
+
+func playerTag(name string, c tak.Color) string {
+	if c == tak.White {
+		return name + "1"
+	}
+	return name + "2"
+}
+
+// Player returns the name of the player of `c`, from the Player1
+// or Player2 tag.
+func (p *PTN) Player(c tak.Color) string {
+	return p.FindTag(playerTag("Player", c))
+}
+
+func (p *PTN) SetPlayer(c tak.Color, name string) {
+	p.SetTag(playerTag("Player", c), name)
+}
+
+// Rating returns the rating of the player of `c`, from the Rating1
+// or Rating2 tag, or 0 if there is none.
+func (p *PTN) Rating(c tak.Color) (int, error) {
+	name := playerTag("Rating", c)
+	v := p.FindTag(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, e := strconv.Atoi(v)
+	if e != nil {
+		return 0, fmt.Errorf("bad %s: %s", name, v)
+	}
+	return n, nil
+}
+
+func (p *PTN) SetRating(c tak.Color, rating int) {
+	p.SetTag(playerTag("Rating", c), strconv.Itoa(rating))
+}
+
+// Date returns the day of the game from the Date tag, written
+// `2006.01.02` or `2006-01-02`.
+func (p *PTN) Date() (time.Time, error) {
+	v := p.FindTag("Date")
+	for _, f := range []string{dateFormat, "2006-01-02"} {
+		if t, e := time.Parse(f, v); e == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bad Date: %s", v)
+}
+
+// Time returns the time the game started, in UTC, from the Date
+// and Time tags. A Time tag holding a full RFC 3339 timestamp, as
+// older game logs have, is used on its own.
+func (p *PTN) Time() (time.Time, error) {
+	v := p.FindTag("Time")
+	if t, e := time.Parse(time.RFC3339, v); e == nil {
+		return t.UTC(), nil
+	}
+	clock, e := time.Parse(timeFormat, v)
+	if e != nil {
+		return time.Time{}, fmt.Errorf("bad Time: %s", v)
+	}
+	day, e := p.Date()
+	if e != nil {
+		return time.Time{}, e
+	}
+	return day.Add(time.Duration(clock.Hour())*time.Hour +
+		time.Duration(clock.Minute())*time.Minute +
+		time.Duration(clock.Second())*time.Second), nil
+}
+
+// SetTime sets the Date and Time tags to the start of the game, in
+// UTC.
+func (p *PTN) SetTime(t time.Time) {
+	t = t.UTC()
+	p.SetTag("Date", t.Format(dateFormat))
+	p.SetTag("Time", t.Format(timeFormat))
+}
+
+// A Clock is the time control of a game: each player starts with
+// Time and gains Increment after each move.
+type Clock struct {
+	Time      time.Duration
+	Increment time.Duration
+}
+
+// Clock returns the time control from the Clock tag, written as
+// minutes and seconds with an optional increment in seconds, as in
+// `10:0 +5`.
+func (p *PTN) Clock() (Clock, error) {
+	v := p.FindTag("Clock")
+	bad := fmt.Errorf("bad Clock: %s", v)
+	words := strings.Fields(v)
+	if len(words) == 0 || len(words) > 2 {
+		return Clock{}, bad
+	}
+	ms := strings.Split(words[0], ":")
+	if len(ms) != 2 {
+		return Clock{}, bad
+	}
+	mins, e1 := strconv.Atoi(ms[0])
+	secs, e2 := strconv.Atoi(ms[1])
+	if e1 != nil || e2 != nil || mins < 0 || secs < 0 || secs >= 60 {
+		return Clock{}, bad
+	}
+	c := Clock{Time: time.Duration(mins)*time.Minute + time.Duration(secs)*time.Second}
+	if len(words) == 2 {
+		inc, e := strconv.Atoi(strings.TrimPrefix(words[1], "+"))
+		if e != nil || inc < 0 || !strings.HasPrefix(words[1], "+") {
+			return Clock{}, bad
+		}
+		c.Increment = time.Duration(inc) * time.Second
+	}
+	return c, nil
+}
+
+func (p *PTN) SetClock(c Clock) {
+	v := fmt.Sprintf("%d:%d", int(c.Time/time.Minute), int(c.Time%time.Minute/time.Second))
+	if c.Increment != 0 {
+		v += fmt.Sprintf(" +%d", int(c.Increment/time.Second))
+	}
+	p.SetTag("Clock", v)
+}
+
+// Result returns the result from the Result tag, or nil if there is
+// none.
+func (p *PTN) Result() (*Result, error) {
+	v := p.FindTag("Result")
+	if v == "" {
+		return nil, nil
+	}
+	if !resultRE.MatchString(v) {
+		return nil, fmt.Errorf("bad Result: %s", v)
+	}
+	return &Result{Result: v}, nil
+}
+
+func (p *PTN) SetResult(result string) {
+	p.SetTag("Result", result)
+}
+
+// SetTPS sets the TPS tag to start the game from `pos`, and the
+// rules tags to its rules.
+func (p *PTN) SetTPS(pos *tak.Position) {
+	p.SetConfig(pos.Config())
+	p.SetTag("TPS", FormatTPS(pos))
+}
+
+// Validate checks the tags of `p` against the PTN specification. It
+// returns an error for a missing Size tag or a tag with a malformed
+// value, and warnings for unknown and repeated tags.
+func (p *PTN) Validate() (warnings []string, err error) {
+	seen := make(map[string]bool)
+	for _, t := range p.Tags {
+		if !knownTags[t.Name] {
+			warnings = append(warnings, fmt.Sprintf("unknown tag: %s", t.Name))
+		}
+		if seen[t.Name] {
+			warnings = append(warnings, fmt.Sprintf("repeated tag: %s", t.Name))
+		}
+		seen[t.Name] = true
+	}
+	if _, e := p.Config(); e != nil {
+		return warnings, e
+	}
+	if seen["Date"] {
+		if _, e := p.Date(); e != nil {
+			return warnings, e
+		}
+	}
+	if seen["Time"] {
+		if _, e := p.Time(); e != nil {
+			return warnings, e
+		}
+	}
+	if seen["Clock"] {
+		if _, e := p.Clock(); e != nil {
+			return warnings, e
+		}
+	}
+	for _, c := range []tak.Color{tak.White, tak.Black} {
+		if _, e := p.Rating(c); e != nil {
+			return warnings, e
+		}
+	}
+	if _, e := p.Result(); e != nil {
+		return warnings, e
+	}
+	if _, e := p.Id(); e != nil {
+		return warnings, e
+	}
+	if seen["TPS"] {
+		if _, e := p.InitialPosition(); e != nil {
+			return warnings, e
+		}
+	}
+	return warnings, nil
+}
@@ -0,0 +1,150 @@
+package ptn
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"../tak"
+)
+
+func TestTagAccessors(t *testing.T) {
+	p := &PTN{}
+	p.SetConfig(tak.Config{Size: 6, HalfKomi: 4})
+	start := time.Date(2016, 5, 7, 10, 17, 3, 0, time.UTC)
+	p.SetTime(start)
+	p.SetPlayer(tak.White, "Guest369")
+	p.SetPlayer(tak.Black, "TakticianBot")
+	p.SetRating(tak.Black, 1650)
+	p.SetClock(Clock{Time: 10 * time.Minute, Increment: 5 * time.Second})
+	p.SetResult("0-R")
+	p.SetId(1334)
+
+	want := []Tag{
+		{"Size", "6"},
+		{"Komi", "2"},
+		{"Date", "2016.05.07"},
+		{"Time", "10:17:03"},
+		{"Player1", "Guest369"},
+		{"Player2", "TakticianBot"},
+		{"Rating2", "1650"},
+		{"Clock", "10:0 +5"},
+		{"Result", "0-R"},
+		{"Id", "1334"},
+	}
+	if !reflect.DeepEqual(p.Tags, want) {
+		t.Fatalf("tags=%v", p.Tags)
+	}
+	if w, e := p.Validate(); len(w) != 0 || e != nil {
+		t.Errorf("Validate: %v, %v", w, e)
+	}
+
+	if n, e := p.Size(); n != 6 || e != nil {
+		t.Errorf("Size=%d, %v", n, e)
+	}
+	if k, e := p.Komi(); k != 4 || e != nil {
+		t.Errorf("Komi=%d, %v", k, e)
+	}
+	if r, e := p.Reserves(); r != nil || e != nil {
+		t.Errorf("Reserves=%v, %v", r, e)
+	}
+	if got, e := p.Time(); !got.Equal(start) || e != nil {
+		t.Errorf("Time=%v, %v", got, e)
+	}
+	if p.Player(tak.White) != "Guest369" || p.Player(tak.Black) != "TakticianBot" {
+		t.Errorf("players=%q,%q", p.Player(tak.White), p.Player(tak.Black))
+	}
+	if r, e := p.Rating(tak.White); r != 0 || e != nil {
+		t.Errorf("Rating1=%d, %v", r, e)
+	}
+	if c, e := p.Clock(); c != (Clock{10 * time.Minute, 5 * time.Second}) || e != nil {
+		t.Errorf("Clock=%v, %v", c, e)
+	}
+	if r, e := p.Result(); e != nil || r.Winner() != tak.Black {
+		t.Errorf("Result=%v, %v", r, e)
+	}
+	if id, e := p.Id(); id != 1334 || e != nil {
+		t.Errorf("Id=%d, %v", id, e)
+	}
+
+	p.SetConfig(tak.Config{Size: 5, Reserves: tak.ReservesFor(5, 20, 0)})
+	if r, e := p.Reserves(); e != nil || *r != (tak.Reserves{WhiteStones: 20, BlackStones: 20}) {
+		t.Errorf("Reserves=%v, %v", r, e)
+	}
+	if p.FindTag("Komi") != "" {
+		t.Errorf("Komi survived SetConfig")
+	}
+}
+
+func TestCapFlattenRoundTrip(t *testing.T) {
+	p := &PTN{}
+	p.SetConfig(tak.Config{Size: 5, NoCapstoneFlatten: true})
+	p.AddMoves([]tak.Move{{X: 0, Y: 0, Type: tak.PlaceFlat}})
+	parsed, e := ParsePTN(strings.NewReader(p.Render()))
+	if e != nil {
+		t.Fatal(e)
+	}
+	cfg, e := parsed.Config()
+	if e != nil || !cfg.NoCapstoneFlatten {
+		t.Fatalf("Config=%+v, %v", cfg, e)
+	}
+	pos, e := parsed.PositionAtMove(0, tak.NoColor)
+	if e != nil || !pos.Config().NoCapstoneFlatten {
+		t.Fatalf("replayed without the rule: %v", e)
+	}
+	if warnings, e := parsed.Validate(); len(warnings) != 0 || e != nil {
+		t.Errorf("Validate=%v, %v", warnings, e)
+	}
+
+	parsed.SetConfig(tak.Config{Size: 5})
+	if parsed.FindTag("CapFlatten") != "" {
+		t.Errorf("CapFlatten survived SetConfig")
+	}
+}
+
+func TestLegacyTimeTags(t *testing.T) {
+	p := &PTN{Tags: []Tag{
+		{"Size", "5"},
+		{"Date", "2016-05-07"},
+		{"Time", "2016-05-07T10:17:03Z"},
+	}}
+	want := time.Date(2016, 5, 7, 10, 17, 3, 0, time.UTC)
+	if got, e := p.Time(); !got.Equal(want) || e != nil {
+		t.Errorf("Time=%v, %v", got, e)
+	}
+	if got, e := p.Date(); e != nil || got.Day() != 7 {
+		t.Errorf("Date=%v, %v", got, e)
+	}
+}
+
+func TestValidateTags(t *testing.T) {
+	cases := []struct {
+		tags     []Tag
+		warnings int
+		ok       bool
+	}{
+		{[]Tag{{"Size", "5"}}, 0, true},
+		{[]Tag{{"Size", "5"}, {"Opening", "swap"}, {"Size", "5"}}, 2, true},
+		{[]Tag{{"Player1", "x"}}, 0, false},
+		{[]Tag{{"Size", "9"}}, 0, false},
+		{[]Tag{{"Size", "5"}, {"Komi", "x"}}, 0, false},
+		{[]Tag{{"Size", "5"}, {"Caps", "-1"}}, 0, false},
+		{[]Tag{{"Size", "5"}, {"Date", "May 7"}}, 0, false},
+		{[]Tag{{"Size", "5"}, {"Date", "2016.05.07"}, {"Time", "25:00:00"}}, 0, false},
+		{[]Tag{{"Size", "5"}, {"Clock", "10"}}, 0, false},
+		{[]Tag{{"Size", "5"}, {"Clock", "10:0 5"}}, 0, false},
+		{[]Tag{{"Size", "5"}, {"Rating2", "high"}}, 0, false},
+		{[]Tag{{"Size", "5"}, {"Result", "It Works!"}}, 0, false},
+		{[]Tag{{"Size", "5"}, {"Id", "Game#12"}}, 0, false},
+		{[]Tag{{"Size", "5"}, {"TPS", "x4/x4/x4/x4 1 1"}}, 0, false},
+		{[]Tag{{"Size", "4"}, {"TPS", "x4/x4/x4/x4 1 1"}}, 0, true},
+	}
+	for i, tc := range cases {
+		p := &PTN{Tags: tc.tags}
+		w, e := p.Validate()
+		if len(w) != tc.warnings || (e == nil) != tc.ok {
+			t.Errorf("%d: Validate(%v) = %v, %v", i, tc.tags, w, e)
+		}
+	}
+}
@@ -3,48 +3,119 @@ package ptn
 import (
 	"errors"
 	"fmt"
-	"strconv"
 	"strings"
 
 	"../tak"
 )
 
+var (
+	ErrTPSFields = errors.New("wrong number of fields")
+	ErrTPSTurn   = errors.New("bad turn")
+	ErrTPSMove   = errors.New("bad move number")
+	ErrTPSSize   = errors.New("bad board size")
+	ErrTPSRow    = errors.New("wrong row length")
+	ErrTPSSquare = errors.New("malformed square")
+)
+
+// A TPSError describes a malformed TPS string. Row and Column locate
+// the offending square, counting from 1 as PTN does, so that row 1
+// is the last row written; Column is 0 for an error about a whole
+// row, and both are 0 for one about the whole string. Err is one of
+// the ErrTPS errors, or the error from tak.FromSquares.
+type TPSError struct {
+	Row, Column int
+	Text        string
+	Err         error
+}
+
+func (e *TPSError) Error() string {
+	where := ""
+	switch {
+	case e.Column > 0:
+		where = " at " + FormatSquare(tak.Coord{X: e.Column - 1, Y: e.Row - 1})
+	case e.Row > 0:
+		where = fmt.Sprintf(" in row %d", e.Row)
+	}
+	err := e.Err
+	var se *tak.SquareError
+	if errors.As(err, &se) {
+		err = se.Err
+	}
+	if e.Text == "" {
+		return fmt.Sprintf("bad TPS%s: %v", where, err)
+	}
+	return fmt.Sprintf("bad TPS%s: %v: %q", where, err, e.Text)
+}
+
+func (e *TPSError) Unwrap() error {
+	return e.Err
+}
+
 func ParseTPS(tpn string) (*tak.Position, error) {
-	var pieces [][]tak.Square
+	return ParseTPSConfig(tpn, tak.Config{})
+}
+
+// ParseTPSConfig parses a TPS string into a position using the
+// rules in `cfg`. The board size is taken from the TPS, and the
+// pieces on the board must fit in the reserves `cfg` gives each
+// side. Errors are returned as a *TPSError.
+func ParseTPSConfig(tpn string, cfg tak.Config) (*tak.Position, error) {
 	words := strings.Split(tpn, " ")
 	if len(words) != 3 {
-		return nil, errors.New("bad TPN: wrong number of words")
+		return nil, &TPSError{Err: ErrTPSFields}
 	}
-	turn, err := strconv.Atoi(words[1])
-	if err != nil {
-		return nil, fmt.Errorf("bad turn: %s", words[1])
+	if words[1] != "1" && words[1] != "2" {
+		return nil, &TPSError{Text: words[1], Err: ErrTPSTurn}
 	}
-	if turn != 1 && turn != 2 {
-		return nil, fmt.Errorf("bad turn: %s", words[1])
-	}
-	move, err := strconv.Atoi(words[2])
-	if err != nil {
-		return nil, fmt.Errorf("bad move: %s", words[2])
+	turn := int(words[1][0] - '0')
+	move, ok := parseCount(words[2])
+	if !ok {
+		return nil, &TPSError{Text: words[2], Err: ErrTPSMove}
 	}
 	move = 2*(move-1) + (turn - 1)
 
 	rows := strings.Split(words[0], "/")
-	for _, r := range rows {
-		row, err := parseRow(r)
+	size := len(rows)
+	if size < 3 || size > 8 {
+		return nil, &TPSError{Text: words[0], Err: ErrTPSSize}
+	}
+	pieces := make([][]tak.Square, size)
+	for i, r := range rows {
+		y := size - i - 1
+		row, err := parseRow(r, size, y)
 		if err != nil {
 			return nil, err
 		}
-		pieces = append([][]tak.Square{row}, pieces...)
+		pieces[y] = row
 	}
-	if len(pieces) < 3 || len(pieces) > 8 {
-		return nil, fmt.Errorf("bad size board: %d", len(pieces))
+	cfg.Size = size
+	p, err := tak.FromSquares(cfg, pieces, move)
+	if err != nil {
+		e := &TPSError{Err: err}
+		var se *tak.SquareError
+		if errors.As(err, &se) {
+			e.Row, e.Column = se.Y+1, se.X+1
+			e.Text = tpsSquare(pieces[se.Y][se.X])
+		}
+		return nil, e
+	}
+	return p, nil
+}
+
+// parseCount parses a positive decimal count, small enough that
+// move numbers computed from it cannot overflow.
+func parseCount(s string) (int, bool) {
+	if len(s) == 0 || len(s) > 6 {
+		return 0, false
 	}
-	for i, r := range pieces {
-		if len(r) != len(pieces) {
-			return nil, fmt.Errorf("row %d bad length: %d", i, len(r))
+	n := 0
+	for _, c := range []byte(s) {
+		if c < '0' || c > '9' {
+			return 0, false
 		}
+		n = 10*n + int(c-'0')
 	}
-	return tak.FromSquares(tak.Config{Size: len(pieces)}, pieces, move)
+	return n, n > 0
 }
 
 func FormatTPS(p *tak.Position) string {
@@ -98,43 +169,57 @@ func tpsSquare(sq tak.Square) string {
 	return string(out)
 }
 
-func parseRow(row string) ([]tak.Square, error) {
-	var out []tak.Square
-	bits := strings.Split(row, ",")
-	for _, bit := range bits {
-		if bit[0] == 'x' {
+// parseRow parses row `y`, counting from the bottom, of a board of
+// `size`.
+func parseRow(row string, size, y int) ([]tak.Square, error) {
+	out := make([]tak.Square, 0, size)
+	for _, bit := range strings.Split(row, ",") {
+		x := len(out)
+		bad := &TPSError{Row: y + 1, Column: x + 1, Text: bit, Err: ErrTPSSquare}
+		if x == size {
+			return nil, &TPSError{Row: y + 1, Text: row, Err: ErrTPSRow}
+		}
+		if strings.HasPrefix(bit, "x") {
 			count := 1
 			if len(bit) > 1 {
-				count = int(bit[1] - '0')
+				var ok bool
+				if count, ok = parseCount(bit[1:]); !ok {
+					return nil, bad
+				}
 			}
-			for i := 0; i < count; i++ {
-				out = append(out, nil)
+			if x+count > size {
+				return nil, &TPSError{Row: y + 1, Text: row, Err: ErrTPSRow}
 			}
+			out = out[:x+count]
 			continue
 		}
-		stack := make(tak.Square, len(bit))
-		for i, b := range bit {
+		stones := strings.TrimRight(bit, "CS")
+		if len(stones) == 0 || len(bit)-len(stones) > 1 {
+			return nil, bad
+		}
+		stack := make(tak.Square, len(stones))
+		for i, b := range []byte(stones) {
+			var color tak.Color
 			switch b {
 			case '1':
-				stack[len(stack)-i-1] = tak.MakePiece(tak.White, tak.Flat)
+				color = tak.White
 			case '2':
-				stack[len(stack)-i-1] = tak.MakePiece(tak.Black, tak.Flat)
-			case 'C', 'S':
-				if i != len(bit)-1 {
-					return nil, fmt.Errorf("stone type not at end of stack: %s", bit)
-				}
-				stack = stack[1:]
-				color := stack[0].Color()
-				if b == 'S' {
-					stack[0] = tak.MakePiece(color, tak.Standing)
-				} else {
-					stack[0] = tak.MakePiece(color, tak.Capstone)
-				}
+				color = tak.Black
 			default:
-				return nil, fmt.Errorf("malformed stack: %s", bit)
+				return nil, bad
 			}
+			stack[len(stack)-i-1] = tak.MakePiece(color, tak.Flat)
+		}
+		switch bit[len(bit)-1] {
+		case 'S':
+			stack[0] = tak.MakePiece(stack[0].Color(), tak.Standing)
+		case 'C':
+			stack[0] = tak.MakePiece(stack[0].Color(), tak.Capstone)
 		}
 		out = append(out, stack)
 	}
+	if len(out) != size {
+		return nil, &TPSError{Row: y + 1, Text: row, Err: ErrTPSRow}
+	}
 	return out, nil
 }
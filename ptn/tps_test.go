@@ -1,7 +1,9 @@
 package ptn
 
 import (
+	"errors"
 	"reflect"
+	"strings"
 	"testing"
 
 	"../tak"
@@ -126,3 +128,99 @@ func TestRenderTPS(t *testing.T) {
 		t.Fatalf("FormatTPS:\n in= `%s`\n out=`%s`", tps, out)
 	}
 }
+
+func TestTallStackTPS(t *testing.T) {
+	// every white stone and all but one black stone in a single
+	// stack, under a black capstone
+	stack := strings.Repeat("12", 49) + "12C"
+	tps := "x8/x8/x8/x8/x8/x8/x8/x3," + stack + ",x4 2 51"
+	p, e := ParseTPS(tps)
+	if e != nil {
+		t.Fatal("parse error", e)
+	}
+	sq := p.At(3, 0)
+	if len(sq) != 100 {
+		t.Fatalf("height=%d", len(sq))
+	}
+	if sq[0] != tak.MakePiece(tak.Black, tak.Capstone) {
+		t.Errorf("top=%v", sq[0])
+	}
+	if sq[99] != tak.MakePiece(tak.White, tak.Flat) ||
+		sq[98] != tak.MakePiece(tak.Black, tak.Flat) {
+		t.Errorf("bottom=%v,%v", sq[99], sq[98])
+	}
+	if p.WhiteStones() != 0 || p.BlackStones() != 1 {
+		t.Errorf("stones=%d,%d", p.WhiteStones(), p.BlackStones())
+	}
+	if out := FormatTPS(p); out != tps {
+		t.Fatalf("FormatTPS:\n in= `%s`\n out=`%s`", tps, out)
+	}
+}
+
+func TestParseTPSErrors(t *testing.T) {
+	cases := []struct {
+		tps         string
+		err         error
+		row, column int
+	}{
+		{"x3/x3/x3 1", ErrTPSFields, 0, 0},
+		{"x3/x3/x3 3 1", ErrTPSTurn, 0, 0},
+		{"x3/x3/x3 1 0", ErrTPSMove, 0, 0},
+		{"x3/x3/x3 1 -2", ErrTPSMove, 0, 0},
+		{"x3/x3 1 1", ErrTPSSize, 0, 0},
+		{"x9/x9/x9/x9/x9/x9/x9/x9/x9 1 1", ErrTPSSize, 0, 0},
+		{"x3/x2/x3 1 1", ErrTPSRow, 2, 0},
+		{"x3/x3/x,1,2,1 1 1", ErrTPSRow, 1, 0},
+		{"x12/x8/x8/x8/x8/x8/x8/x8 1 1", ErrTPSRow, 8, 0},
+		{"x3/x,,x/x3 1 1", ErrTPSSquare, 2, 2},
+		{"x3/x3/x0,x3 1 1", ErrTPSSquare, 1, 1},
+		{"x3/1,x+1,x/x3 1 1", ErrTPSSquare, 2, 2},
+		{"x3/x3/x2,C 1 1", ErrTPSSquare, 1, 3},
+		{"x3/x3/x,1SC,x 1 1", ErrTPSSquare, 1, 2},
+		{"x3/x3/x,1C2,x 1 1", ErrTPSSquare, 1, 2},
+		{"x3/x3/x,13,x 1 1", ErrTPSSquare, 1, 2},
+		{"x5/x5/x5/x5/x3,1C,1C 1 3", tak.ErrTooManyCaps, 1, 5},
+		{"x4/x4/x4/x,1C,x2 1 3", tak.ErrTooManyCaps, 1, 2},
+		{"x3/x3/x2," + strings.Repeat("1", 11) + " 1 20", tak.ErrTooManyStones, 1, 3},
+		{"x3/x3/" + strings.Repeat("12", 10) + ",2,2 1 20", tak.ErrTooManyStones, 1, 2},
+	}
+	for _, tc := range cases {
+		_, e := ParseTPS(tc.tps)
+		var te *TPSError
+		if !errors.As(e, &te) || !errors.Is(e, tc.err) ||
+			te.Row != tc.row || te.Column != tc.column {
+			t.Errorf("ParseTPS(%q): err=%v want %v at %d,%d",
+				tc.tps, e, tc.err, tc.row, tc.column)
+		}
+	}
+}
+
+func FuzzTPS(f *testing.F) {
+	for _, s := range []string{
+		"x3/x3/x3 1 1",
+		"x,1,2/x3/21S,x2 2 3",
+		"x3,12,2S/x,22S,22C,11,21/121,212,12,1121C,1212S/21S,1,21,211S,12S/x,21S,2,x2 1 26",
+		"x8/x8/x8/x8/x8/x8/x8/x3,12C,x4 2 51",
+		"x1,x2/x,x,x/2,x1,x 2 1",
+		"x3/x2,C/x3 1 1",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		p, e := ParseTPS(s)
+		if e != nil {
+			return
+		}
+		out := FormatTPS(p)
+		q, e := ParseTPS(out)
+		if e != nil {
+			t.Fatalf("ParseTPS(FormatTPS(%q)) = %q: %v", s, out, e)
+		}
+		if again := FormatTPS(q); again != out {
+			t.Fatalf("FormatTPS not canonical: %q -> %q -> %q", s, out, again)
+		}
+		if q.Hash() != p.Hash() {
+			t.Fatalf("%q: hash changed round-tripping via %q", s, out)
+		}
+	})
+}
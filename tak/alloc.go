@@ -2,12 +2,16 @@ package tak
 
 import "fmt"
 
+// Each Groups array holds the groups of both colors. FloodGroups
+// omits single squares, so there can be at most one group for every
+// two squares on the board.
 type position3 struct {
 	Position
 	alloc struct {
 		Height [3 * 3]uint8
 		Stacks [3 * 3]uint64
-		Groups [6]uint64
+		Deep   [3 * 3]uint64
+		Groups [3 * 3 / 2]uint64
 	}
 }
 
@@ -16,7 +20,8 @@ type position4 struct {
 	alloc struct {
 		Height [4 * 4]uint8
 		Stacks [4 * 4]uint64
-		Groups [8]uint64
+		Deep   [4 * 4]uint64
+		Groups [4 * 4 / 2]uint64
 	}
 }
 
@@ -25,7 +30,8 @@ type position5 struct {
 	alloc struct {
 		Height [5 * 5]uint8
 		Stacks [5 * 5]uint64
-		Groups [10]uint64
+		Deep   [5 * 5]uint64
+		Groups [5 * 5 / 2]uint64
 	}
 }
 
@@ -34,7 +40,8 @@ type position6 struct {
 	alloc struct {
 		Height [6 * 6]uint8
 		Stacks [6 * 6]uint64
-		Groups [12]uint64
+		Deep   [6 * 6]uint64
+		Groups [6 * 6 / 2]uint64
 	}
 }
 
@@ -43,7 +50,8 @@ type position7 struct {
 	alloc struct {
 		Height [7 * 7]uint8
 		Stacks [7 * 7]uint64
-		Groups [14]uint64
+		Deep   [7 * 7]uint64
+		Groups [7 * 7 / 2]uint64
 	}
 }
 
@@ -52,7 +60,8 @@ type position8 struct {
 	alloc struct {
 		Height [8 * 8]uint8
 		Stacks [8 * 8]uint64
-		Groups [16]uint64
+		Deep   [8 * 8]uint64
+		Groups [8 * 8 / 2]uint64
 	}
 }
 
@@ -62,54 +71,66 @@ func alloc(tpl *Position) *Position {
 		a := &position3{Position: *tpl}
 		a.Height = a.alloc.Height[:]
 		a.Stacks = a.alloc.Stacks[:]
-		a.analysis.WhiteGroups = a.alloc.Groups[:0]
+		a.deep = a.alloc.Deep[:]
+		copyAnalysis(&a.analysis, &tpl.analysis, a.alloc.Groups[:0])
 		copy(a.Height, tpl.Height)
 		copy(a.Stacks, tpl.Stacks)
+		copy(a.deep, tpl.deep)
 
 		return &a.Position
 	case 4:
 		a := &position4{Position: *tpl}
 		a.Height = a.alloc.Height[:]
 		a.Stacks = a.alloc.Stacks[:]
-		a.analysis.WhiteGroups = a.alloc.Groups[:0]
+		a.deep = a.alloc.Deep[:]
+		copyAnalysis(&a.analysis, &tpl.analysis, a.alloc.Groups[:0])
 		copy(a.Height, tpl.Height)
 		copy(a.Stacks, tpl.Stacks)
+		copy(a.deep, tpl.deep)
 
 		return &a.Position
 	case 5:
 		a := &position5{Position: *tpl}
 		a.Height = a.alloc.Height[:]
 		a.Stacks = a.alloc.Stacks[:]
-		a.analysis.WhiteGroups = a.alloc.Groups[:0]
+		a.deep = a.alloc.Deep[:]
+		copyAnalysis(&a.analysis, &tpl.analysis, a.alloc.Groups[:0])
 		copy(a.Height, tpl.Height)
 		copy(a.Stacks, tpl.Stacks)
+		copy(a.deep, tpl.deep)
 
 		return &a.Position
 	case 6:
 		a := &position6{Position: *tpl}
 		a.Height = a.alloc.Height[:]
 		a.Stacks = a.alloc.Stacks[:]
-		a.analysis.WhiteGroups = a.alloc.Groups[:0]
+		a.deep = a.alloc.Deep[:]
+		copyAnalysis(&a.analysis, &tpl.analysis, a.alloc.Groups[:0])
 		copy(a.Height, tpl.Height)
 		copy(a.Stacks, tpl.Stacks)
+		copy(a.deep, tpl.deep)
 
 		return &a.Position
 	case 7:
 		a := &position7{Position: *tpl}
 		a.Height = a.alloc.Height[:]
 		a.Stacks = a.alloc.Stacks[:]
-		a.analysis.WhiteGroups = a.alloc.Groups[:0]
+		a.deep = a.alloc.Deep[:]
+		copyAnalysis(&a.analysis, &tpl.analysis, a.alloc.Groups[:0])
 		copy(a.Height, tpl.Height)
 		copy(a.Stacks, tpl.Stacks)
+		copy(a.deep, tpl.deep)
 
 		return &a.Position
 	case 8:
 		a := &position8{Position: *tpl}
 		a.Height = a.alloc.Height[:]
 		a.Stacks = a.alloc.Stacks[:]
-		a.analysis.WhiteGroups = a.alloc.Groups[:0]
+		a.deep = a.alloc.Deep[:]
+		copyAnalysis(&a.analysis, &tpl.analysis, a.alloc.Groups[:0])
 		copy(a.Height, tpl.Height)
 		copy(a.Stacks, tpl.Stacks)
+		copy(a.deep, tpl.deep)
 
 		return &a.Position
 	default:
@@ -120,15 +141,27 @@ func alloc(tpl *Position) *Position {
 func copyPosition(p *Position, out *Position) {
 	h := out.Height
 	s := out.Stacks
+	d := out.deep
 	g := out.analysis.WhiteGroups
 
 	*out = *p
 	out.Height = h
 	out.Stacks = s
-	out.analysis.WhiteGroups = g[:0]
+	out.deep = d
+	copyAnalysis(&out.analysis, &p.analysis, g[:0])
 
 	copy(out.Height, p.Height)
 	copy(out.Stacks, p.Stacks)
+	copy(out.deep, p.deep)
+}
+
+// copyAnalysis copies the groups in `src` into `dst`, using `buf`
+// as storage, so that `dst` never aliases `src`.
+func copyAnalysis(dst, src *Analysis, buf []uint64) {
+	buf = append(buf[:0], src.WhiteGroups...)
+	dst.WhiteGroups = buf
+	buf = buf[len(buf):len(buf):cap(buf)]
+	dst.BlackGroups = append(buf, src.BlackGroups...)
 }
 
 func Alloc(size int) *Position {
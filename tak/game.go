@@ -2,39 +2,138 @@ package tak
 
 import (
 	"errors"
+	"fmt"
 
 	"../bitboard"
 )
 
 type Config struct {
-	Size      int
+	Size int
+	// Pieces and Capstones are the stones and capstones each side
+	// starts with. Zero selects the standard count for Size; use
+	// Reserves to play with no capstones or uneven sides.
 	Pieces    int
 	Capstones int
 
+	// Reserves, if non-nil, overrides Pieces and Capstones with
+	// explicit per-side counts, any of which may be zero. New
+	// takes a copy, so it may be shared between configs.
+	Reserves *Reserves
+
+	// HalfKomi is the komi awarded to Black in a flat count, in
+	// units of half a flat: 4 is a komi of 2, and 5 is a komi of
+	// 2.5, which makes flat draws impossible.
+	HalfKomi int
+
+	// NoCapstoneFlatten forbids a capstone from flattening a wall.
+	NoCapstoneFlatten bool
+
 	c bitboard.Constants
 }
 
+// Reserves are the pieces each side starts a game with. Together
+// they may not exceed the tallest representable stack.
+type Reserves struct {
+	WhiteStones, WhiteCaps int
+	BlackStones, BlackCaps int
+}
+
+// Valid reports whether a game can be played with reserves `r`.
+func (r *Reserves) Valid() bool {
+	return r.WhiteStones >= 0 && r.WhiteCaps >= 0 &&
+		r.BlackStones >= 0 && r.BlackCaps >= 0 &&
+		r.WhiteStones+r.WhiteCaps+r.BlackStones+r.BlackCaps <= maxHeight
+}
+
+// DefaultReserves returns the standard reserves for a board of
+// `size`, or none if there is no such board.
+func DefaultReserves(size int) Reserves {
+	if size < 0 || size >= len(defaultPieces) {
+		return Reserves{}
+	}
+	return Reserves{
+		WhiteStones: defaultPieces[size], WhiteCaps: defaultCaps[size],
+		BlackStones: defaultPieces[size], BlackCaps: defaultCaps[size],
+	}
+}
+
+// ReservesFor returns reserves giving each side `stones` stones
+// and `caps` capstones on a board of `size`. A negative count
+// selects the standard count for that piece.
+func ReservesFor(size, stones, caps int) *Reserves {
+	r := DefaultReserves(size)
+	if stones >= 0 {
+		r.WhiteStones, r.BlackStones = stones, stones
+	}
+	if caps >= 0 {
+		r.WhiteCaps, r.BlackCaps = caps, caps
+	}
+	return &r
+}
+
+// StartingReserves returns the reserves a game played under `c`
+// starts with.
+func (c *Config) StartingReserves() Reserves {
+	if c.Reserves != nil {
+		return *c.Reserves
+	}
+	r := DefaultReserves(c.Size)
+	if c.Pieces != 0 {
+		r.WhiteStones, r.BlackStones = c.Pieces, c.Pieces
+	}
+	if c.Capstones != 0 {
+		r.WhiteCaps, r.BlackCaps = c.Capstones, c.Capstones
+	}
+	return r
+}
+
+// maxHeight is the tallest stack a Position can represent: a top
+// piece plus 64 buried pieces in Stacks and 64 more in deep. It
+// exceeds every piece on the largest board.
+const maxHeight = 1 + 2*64
+
 var defaultPieces = []int{0, 0, 0, 10, 15, 21, 30, 40, 50}
 var defaultCaps = []int{0, 0, 0, 0, 0, 1, 1, 1, 2}
 
+// Validate returns an error if no game can be played under `c`.
+// Configs built from user input should be validated before being
+// passed to New.
+func (c *Config) Validate() error {
+	if c.Size < 3 || c.Size > 8 {
+		return ErrBadSize
+	}
+	if r := c.StartingReserves(); !r.Valid() {
+		return ErrBadReserves
+	}
+	return nil
+}
+
+// New returns the starting position of a game played under `g`. It
+// panics if `g` is not valid.
 func New(g Config) *Position {
+	if e := g.Validate(); e != nil {
+		panic(fmt.Sprintf("tak.New: %v: %+v", e, g))
+	}
 	if g.Pieces == 0 {
 		g.Pieces = defaultPieces[g.Size]
 	}
 	if g.Capstones == 0 {
 		g.Capstones = defaultCaps[g.Size]
 	}
+	r := g.StartingReserves()
+	if g.Reserves != nil {
+		g.Reserves = &r
+	}
 	g.c = bitboard.Precompute(uint(g.Size))
 	p := alloc(&Position{
 		cfg:         &g,
-		whiteStones: byte(g.Pieces),
-		whiteCaps:   byte(g.Capstones),
-		blackStones: byte(g.Pieces),
-		blackCaps:   byte(g.Capstones),
+		whiteStones: byte(r.WhiteStones),
+		whiteCaps:   byte(r.WhiteCaps),
+		blackStones: byte(r.BlackStones),
+		blackCaps:   byte(r.BlackCaps),
 		move:        0,
-
-		hash: fnvBasis,
 	})
+	p.hash = p.computeHash()
 	return p
 }
 
@@ -58,9 +157,11 @@ type Position struct {
 	Standing uint64
 	Caps     uint64
 	Height   []uint8
-	Stacks   []uint64
-
-	Threatmoves []Move
+	// Stacks records the colors of the pieces beneath the top of
+	// each square: bit j-1 is set if the jth piece down is black.
+	// Pieces more than 64 down spill into deep.
+	Stacks []uint64
+	deep   []uint64
 
 	analysis Analysis
 
@@ -72,18 +173,59 @@ type Analysis struct {
 	BlackGroups []uint64
 }
 
+var (
+	ErrBadSize       = errors.New("board size must be from 3 to 8")
+	ErrBadReserves   = errors.New("illegal reserves")
+	ErrBoardShape    = errors.New("board does not match the size")
+	ErrStackTooTall  = errors.New("stack too tall")
+	ErrBadStone      = errors.New("bad stone")
+	ErrBuriedPiece   = errors.New("wall or capstone below the top of a stack")
+	ErrTooManyStones = errors.New("more stones than the reserves hold")
+	ErrTooManyCaps   = errors.New("more capstones than the reserves hold")
+)
+
+// A SquareError is returned by FromSquares for a square it cannot
+// place. X and Y are the square's column and row.
+type SquareError struct {
+	X, Y int
+	Err  error
+}
+
+func (e *SquareError) Error() string {
+	return fmt.Sprintf("square (%d,%d): %v", e.X, e.Y, e.Err)
+}
+
+func (e *SquareError) Unwrap() error {
+	return e.Err
+}
+
 // FromSquares initializes a Position with the specified squares and
 // move number. `board` is a slice of rows, numbered from low to high,
-// each of which is a slice of positions.
+// each of which is a slice of positions. Only the top of a stack may
+// be a wall or capstone, and each side's pieces must fit in the
+// reserves `cfg` starts it with; the square at which either check
+// fails is reported in a *SquareError.
 func FromSquares(cfg Config, board [][]Square, move int) (*Position, error) {
+	if e := cfg.Validate(); e != nil {
+		return nil, e
+	}
 	p := New(cfg)
 	p.move = move
+	if len(board) != p.Size() {
+		return nil, ErrBoardShape
+	}
 	for y := 0; y < p.Size(); y++ {
+		if len(board[y]) != p.Size() {
+			return nil, ErrBoardShape
+		}
 		for x := 0; x < p.Size(); x++ {
 			sq := board[y][x]
 			if len(sq) == 0 {
 				continue
 			}
+			if len(sq) > maxHeight {
+				return nil, &SquareError{x, y, ErrStackTooTall}
+			}
 			i := uint(x + y*p.Size())
 			switch sq[0].Color() {
 			case White:
@@ -98,29 +240,38 @@ func FromSquares(cfg Config, board [][]Square, move int) (*Position, error) {
 				p.Standing |= (1 << i)
 			}
 			for j, piece := range sq {
+				var count *byte
+				err := ErrTooManyStones
 				switch piece {
 				case MakePiece(White, Capstone):
-					p.whiteCaps--
+					count, err = &p.whiteCaps, ErrTooManyCaps
 				case MakePiece(Black, Capstone):
-					p.blackCaps--
+					count, err = &p.blackCaps, ErrTooManyCaps
 				case MakePiece(White, Flat), MakePiece(White, Standing):
-					p.whiteStones--
+					count = &p.whiteStones
 				case MakePiece(Black, Flat), MakePiece(Black, Standing):
-					p.blackStones--
+					count = &p.blackStones
 				default:
-					return nil, errors.New("bad stone")
+					return nil, &SquareError{x, y, ErrBadStone}
+				}
+				if *count == 0 {
+					return nil, &SquareError{x, y, err}
 				}
+				*count--
 				if j == 0 {
 					continue
 				}
+				if piece.Kind() != Flat {
+					return nil, &SquareError{x, y, ErrBuriedPiece}
+				}
 				if piece.Color() == Black {
-					p.Stacks[i] |= 1 << uint(j-1)
+					p.setBuried(i, uint(j), 1)
 				}
 			}
 			p.Height[i] = uint8(len(sq))
-			p.hash ^= p.hashAt(i)
 		}
 	}
+	p.hash = p.computeHash()
 	p.analyze()
 	return p, nil
 }
@@ -129,6 +280,21 @@ func (p *Position) Size() int {
 	return p.cfg.Size
 }
 
+// Config returns the rules `p` is played under. Its Reserves, if
+// set, are a copy the caller may modify.
+func (p *Position) Config() Config {
+	cfg := *p.cfg
+	if cfg.Reserves != nil {
+		r := *cfg.Reserves
+		cfg.Reserves = &r
+	}
+	return cfg
+}
+
+func (p *Position) HalfKomi() int {
+	return p.cfg.HalfKomi
+}
+
 func (p *Position) At(x, y int) Square {
 	i := uint(x + y*p.Size())
 	if (p.White|p.Black)&(1<<i) == 0 {
@@ -137,7 +303,7 @@ func (p *Position) At(x, y int) Square {
 	sq := make(Square, p.Height[i])
 	sq[0] = p.Top(x, y)
 	for j := uint8(1); j < p.Height[i]; j++ {
-		if p.Stacks[i]&(1<<(j-1)) != 0 {
+		if p.buried(i, uint(j)) != 0 {
 			sq[j] = MakePiece(Black, Flat)
 		} else {
 			sq[j] = MakePiece(White, Flat)
@@ -146,6 +312,39 @@ func (p *Position) At(x, y int) Square {
 	return sq
 }
 
+// buried returns 1 if the jth piece below the top of square `i` is
+// black, and 0 if it is white.
+func (p *Position) buried(i, j uint) uint64 {
+	if j <= 64 {
+		return (p.Stacks[i] >> (j - 1)) & 1
+	}
+	return (p.deep[i] >> (j - 65)) & 1
+}
+
+func (p *Position) setBuried(i, j uint, b uint64) {
+	if j <= 64 {
+		p.Stacks[i] |= b << (j - 1)
+	} else {
+		p.deep[i] |= b << (j - 65)
+	}
+}
+
+// Captives returns the number of white and black pieces buried
+// beneath the top of square `i`.
+func (p *Position) Captives(i int) (white, black int) {
+	h := int(p.Height[i])
+	if h <= 1 {
+		return 0, 0
+	}
+	if h <= 65 {
+		black = bitboard.Popcount(p.Stacks[i] & (1<<uint(h-1) - 1))
+	} else {
+		black = bitboard.Popcount(p.Stacks[i]) +
+			bitboard.Popcount(p.deep[i]&(1<<uint(h-65)-1))
+	}
+	return h - 1 - black, black
+}
+
 func (p *Position) Top(x, y int) Piece {
 	i := uint(x + y*p.Size())
 	var c Color
@@ -177,6 +376,7 @@ func set(p *Position, x, y int, s Square) {
 	p.Caps &= ^(1 << i)
 	if len(s) == 0 {
 		p.Height[i] = 0
+		p.hash = p.computeHash()
 		return
 	}
 	switch s[0].Color() {
@@ -191,15 +391,15 @@ func set(p *Position, x, y int, s Square) {
 	case Capstone:
 		p.Caps |= (1 << i)
 	}
-	p.hash ^= p.hashAt(i)
 	p.Height[i] = uint8(len(s))
 	p.Stacks[i] = 0
+	p.deep[i] = 0
 	for j, piece := range s[1:] {
 		if piece.Color() == Black {
-			p.Stacks[i] |= (1 << uint(j))
+			p.setBuried(i, uint(j+1), 1)
 		}
 	}
-	p.hash ^= p.hashAt(i)
+	p.hash = p.computeHash()
 }
 
 func (p *Position) ToMove() Color {
@@ -219,6 +419,7 @@ func (p *Position) GetHash() uint64 {
 
 func (p *Position) IncrementMove() {
 	p.move++
+	p.hash ^= zobrist.black
 }
 
 func (p *Position) WhiteStones() int {
@@ -315,10 +516,12 @@ func (p *Position) countFlats() (w int, b int) {
 
 func (p *Position) flatsWinner() Color {
 	cw, cb := p.countFlats()
-	if cw > cb {
+	// compare in half-flats so that half-komi never ties
+	w, b := 2*cw, 2*cb+p.cfg.HalfKomi
+	if w > b {
 		return White
 	}
-	if cb > cw {
+	if b > w {
 		return Black
 	}
 	return NoColor
@@ -330,6 +533,10 @@ const (
 	RoadWin WinReason = iota
 	FlatsWin
 	Resignation
+	// RepetitionDraw and PlyLimitDraw are adjudicated by Game,
+	// never by Position.
+	RepetitionDraw
+	PlyLimitDraw
 )
 
 type WinDetails struct {
@@ -338,6 +545,10 @@ type WinDetails struct {
 	Winner     Color
 	WhiteFlats int
 	BlackFlats int
+	HalfKomi   int
+	// Roads lists every road on the board when the game ended by
+	// a road, the winner's first.
+	Roads []Road
 }
 
 func (p *Position) WinDetails() WinDetails {
@@ -346,8 +557,10 @@ func (p *Position) WinDetails() WinDetails {
 	d.Over = over
 	d.Winner = c
 	d.WhiteFlats, d.BlackFlats = p.countFlats()
+	d.HalfKomi = p.cfg.HalfKomi
 	if _, ok := p.hasRoad(); ok {
 		d.Reason = RoadWin
+		d.Roads = p.Roads()
 	} else {
 		d.Reason = FlatsWin
 	}
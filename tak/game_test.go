@@ -1,6 +1,10 @@
 package tak
 
-import "testing"
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
 
 func TestHasRoad(t *testing.T) {
 	p := New(Config{Size: 5})
@@ -72,6 +76,29 @@ func TestHasRoadRegression(t *testing.T) {
 	}
 }
 
+func TestHasRoad8x8(t *testing.T) {
+	// a road through the highest square, which fills bit 63
+	p := New(Config{Size: 8})
+	for x := 0; x < 8; x++ {
+		set(p, x, 7, Square{MakePiece(White, Flat)})
+	}
+	p.analyze()
+	if c, ok := p.hasRoad(); !ok || c != White {
+		t.Errorf("top row: c=%v hasRoad=%v", c, ok)
+	}
+
+	// a row that wraps from h1 onto a2 is not a road
+	p = New(Config{Size: 8})
+	for x := 1; x < 8; x++ {
+		set(p, x, 0, Square{MakePiece(Black, Flat)})
+	}
+	set(p, 0, 1, Square{MakePiece(Black, Flat)})
+	p.analyze()
+	if c, ok := p.hasRoad(); ok {
+		t.Errorf("wrapped row: c=%v hasRoad=%v", c, ok)
+	}
+}
+
 func TestFlatsWinner(t *testing.T) {
 	p := New(Config{Size: 5})
 	set(p, 0, 0, Square{MakePiece(White, Flat)})
@@ -94,6 +121,35 @@ func TestFlatsWinner(t *testing.T) {
 	}
 }
 
+func TestFlatsWinnerKomi(t *testing.T) {
+	cases := []struct {
+		halfKomi int
+		white    int
+		black    int
+		winner   Color
+	}{
+		{0, 3, 3, NoColor},
+		{4, 5, 3, NoColor},
+		{4, 6, 3, White},
+		{5, 5, 3, Black},
+		{5, 6, 3, White},
+		{1, 3, 3, Black},
+	}
+	for _, tc := range cases {
+		p := New(Config{Size: 5, HalfKomi: tc.halfKomi})
+		for i := 0; i < tc.white; i++ {
+			set(p, i%5, i/5, Square{MakePiece(White, Flat)})
+		}
+		for i := 0; i < tc.black; i++ {
+			set(p, i%5, 4-i/5, Square{MakePiece(Black, Flat)})
+		}
+		if w := p.flatsWinner(); w != tc.winner {
+			t.Errorf("komi=%d/2 w=%d b=%d: winner=%s want %s",
+				tc.halfKomi, tc.white, tc.black, w, tc.winner)
+		}
+	}
+}
+
 func TestFlatsWinnerCapLeft(t *testing.T) {
 	p := New(Config{Size: 5})
 	p.whiteStones = 0
@@ -242,3 +298,170 @@ func TestHash(t *testing.T) {
 		t.Fatalf("hash fail when swapping flat/standing")
 	}
 }
+
+func TestHashReserves(t *testing.T) {
+	a := New(Config{Size: 5})
+	b := New(Config{Size: 5})
+	b.whiteStones--
+	b.hash = b.computeHash()
+	if a.Hash() == b.Hash() {
+		t.Fatalf("hash ignores reserves")
+	}
+	c := New(Config{Size: 5})
+	c.IncrementMove()
+	if a.Hash() == c.Hash() {
+		t.Fatalf("hash ignores side to move")
+	}
+}
+
+func TestHashIncremental(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+	for _, size := range []int{3, 4, 5, 6, 7, 8} {
+		for g := 0; g < 10; g++ {
+			p := New(Config{Size: size})
+			for ply := 0; ply < 300; ply++ {
+				if over, _ := p.GameOver(); over {
+					break
+				}
+				moves := p.AllMoves(nil)
+				var next *Position
+				for _, i := range r.Perm(len(moves)) {
+					var e error
+					if next, e = p.Move(&moves[i]); e == nil {
+						break
+					}
+				}
+				if next == nil {
+					break
+				}
+				p = next
+				if h := p.computeHash(); h != p.Hash() {
+					t.Fatalf("size=%d ply=%d: incremental hash=%x computed=%x",
+						size, ply, p.Hash(), h)
+				}
+			}
+		}
+	}
+}
+
+func TestReserves(t *testing.T) {
+	p := New(Config{Size: 5, Reserves: &Reserves{
+		WhiteStones: 10, WhiteCaps: 0,
+		BlackStones: 12, BlackCaps: 2,
+	}})
+	if p.WhiteStones() != 10 || p.WhiteCaps() != 0 ||
+		p.BlackStones() != 12 || p.BlackCaps() != 2 {
+		t.Fatalf("reserves=%d/%d %d/%d", p.WhiteStones(), p.WhiteCaps(),
+			p.BlackStones(), p.BlackCaps())
+	}
+	p.move = 2
+	for _, m := range p.LegalMoves(nil) {
+		if m.Type == PlaceCapstone {
+			t.Fatalf("white has no capstone, but %#v is legal", m)
+		}
+	}
+
+	p = New(Config{Size: 5, Capstones: 3})
+	if p.WhiteCaps() != 3 || p.BlackStones() != 21 {
+		t.Fatalf("caps=%d stones=%d", p.WhiteCaps(), p.BlackStones())
+	}
+
+	r := ReservesFor(6, -1, 0)
+	if *r != (Reserves{30, 0, 30, 0}) {
+		t.Fatalf("ReservesFor=%+v", *r)
+	}
+
+	// configs may share reserves without sharing positions' rules
+	cfg := Config{Size: 6, Reserves: r}
+	p = New(cfg)
+	r.WhiteStones = 1
+	got := p.Config()
+	if got.Reserves.WhiteStones != 30 {
+		t.Fatalf("New did not copy reserves: %+v", *got.Reserves)
+	}
+	got.Reserves.WhiteStones = 2
+	if p.Config().Reserves.WhiteStones != 30 {
+		t.Fatalf("Config did not copy reserves: %+v", *p.Config().Reserves)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	cases := []struct {
+		cfg Config
+		err error
+	}{
+		{Config{Size: 5}, nil},
+		{Config{Size: 8, HalfKomi: 5, Reserves: ReservesFor(8, 10, 0)}, nil},
+		{Config{Size: 2}, ErrBadSize},
+		{Config{Size: 9}, ErrBadSize},
+		{Config{Size: 9, Reserves: ReservesFor(9, -1, -1)}, ErrBadSize},
+		{Config{Size: 5, Reserves: ReservesFor(5, 100, 1)}, ErrBadReserves},
+		{Config{Size: 5, Pieces: -1}, ErrBadReserves},
+	}
+	for i, tc := range cases {
+		if e := tc.cfg.Validate(); e != tc.err {
+			t.Errorf("%d: Validate()=%v want %v", i, e, tc.err)
+		}
+	}
+	if _, e := FromSquares(Config{Size: 3, Capstones: -2},
+		[][]Square{{nil, nil, nil}, {nil, nil, nil}, {nil, nil, nil}}, 0); e != ErrBadReserves {
+		t.Errorf("FromSquares: %v", e)
+	}
+}
+
+func TestFromSquaresErrors(t *testing.T) {
+	wf, bf := MakePiece(White, Flat), MakePiece(Black, Flat)
+	wc := MakePiece(White, Capstone)
+	cases := []struct {
+		cfg  Config
+		x, y int
+		sq   Square
+		err  error
+	}{
+		{Config{Size: 5}, 1, 2, Square{wf, wc}, ErrBuriedPiece},
+		{Config{Size: 5}, 0, 4, Square{bf, MakePiece(Black, Standing)}, ErrBuriedPiece},
+		{Config{Size: 5}, 3, 0, Square{wc, wc}, ErrTooManyCaps},
+		{Config{Size: 4}, 2, 1, Square{wc}, ErrTooManyCaps},
+		{Config{Size: 3, Pieces: 2}, 2, 2, Square{wf, bf, wf, wf}, ErrTooManyStones},
+		{Config{Size: 5}, 4, 3, Square{MakePiece(White, 0)}, ErrBadStone},
+	}
+	for i, tc := range cases {
+		board := make([][]Square, tc.cfg.Size)
+		for y := range board {
+			board[y] = make([]Square, tc.cfg.Size)
+		}
+		board[tc.y][tc.x] = tc.sq
+		_, e := FromSquares(tc.cfg, board, 4)
+		var se *SquareError
+		if !errors.As(e, &se) || se.X != tc.x || se.Y != tc.y || se.Err != tc.err {
+			t.Errorf("%d: err=%v want (%d,%d): %v", i, e, tc.x, tc.y, tc.err)
+		}
+	}
+
+	if _, e := FromSquares(Config{Size: 5}, make([][]Square, 4), 0); e != ErrBoardShape {
+		t.Errorf("short board: err=%v", e)
+	}
+}
+
+func TestNoCapstoneFlatten(t *testing.T) {
+	for _, flatten := range []bool{true, false} {
+		p := New(Config{Size: 5, NoCapstoneFlatten: !flatten})
+		p.move = 2
+		set(p, 2, 2, Square{MakePiece(White, Capstone)})
+		set(p, 2, 3, Square{MakePiece(Black, Standing)})
+		m := Move{X: 2, Y: 2, Type: SlideUp, Slides: []byte{1}}
+		_, e := p.Move(&m)
+		if (e == nil) != flatten {
+			t.Errorf("flatten=%v: move err=%v", flatten, e)
+		}
+		legal := false
+		for _, lm := range p.LegalMoves(nil) {
+			if lm.Equal(&m) {
+				legal = true
+			}
+		}
+		if legal != flatten {
+			t.Errorf("flatten=%v: LegalMoves includes smash=%v", flatten, legal)
+		}
+	}
+}
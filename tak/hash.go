@@ -2,46 +2,103 @@ package tak
 
 import "math/rand"
 
-const (
-	fnvBasis = 14695981039346656037
-	fnvPrime = 1099511628211
-)
-
-var basis [64]uint64
+// zobrist holds the random keys for the position hash. A
+// position's hash is the XOR of
+//
+//   - piece[i][h][c] for every piece of color c (0 = white, 1 = black)
+//     at height h (0 = bottom) on square i,
+//   - standing[i] or capstone[i] for a wall or capstone on top of i,
+//   - black if black is to move,
+//   - stones[c][n] and caps[c][n] for the reserves remaining in hand.
+//
+// Hashes are maintained incrementally as moves are made.
+var zobrist struct {
+	piece    [64][maxHeight][2]uint64
+	standing [64]uint64
+	capstone [64]uint64
+	black    uint64
+	stones   [2][256]uint64
+	caps     [2][256]uint64
+}
 
 func init() {
 	r := rand.New(rand.NewSource(0x7a3))
-	for i := 0; i < 64; i++ {
-		basis[i] = uint64(r.Int63())
+	for i := range zobrist.piece {
+		for h := range zobrist.piece[i] {
+			zobrist.piece[i][h][0] = r.Uint64()
+			zobrist.piece[i][h][1] = r.Uint64()
+		}
+		zobrist.standing[i] = r.Uint64()
+		zobrist.capstone[i] = r.Uint64()
+	}
+	zobrist.black = r.Uint64()
+	for c := 0; c < 2; c++ {
+		for n := range zobrist.stones[c] {
+			zobrist.stones[c][n] = r.Uint64()
+			zobrist.caps[c][n] = r.Uint64()
+		}
+	}
+}
+
+// hashKind returns the key for the kind of the top piece on `i`.
+func (p *Position) hashKind(i uint) uint64 {
+	switch {
+	case p.Standing&(1<<i) != 0:
+		return zobrist.standing[i]
+	case p.Caps&(1<<i) != 0:
+		return zobrist.capstone[i]
 	}
+	return 0
 }
 
-func hash8(basis uint64, b byte) uint64 {
-	return (basis ^ uint64(b)) * fnvPrime
+// hashReserves returns the keys for the pieces left in hand.
+func (p *Position) hashReserves() uint64 {
+	return zobrist.stones[0][p.whiteStones] ^ zobrist.stones[1][p.blackStones] ^
+		zobrist.caps[0][p.whiteCaps] ^ zobrist.caps[1][p.blackCaps]
 }
 
-func hash64(basis uint64, w uint64) uint64 {
-	h := basis
-	h = (h ^ (w & 0xff)) * fnvPrime
-	h = (h ^ ((w >> 8) & 0xff)) * fnvPrime
-	h = (h ^ ((w >> 16) & 0xff)) * fnvPrime
-	h = (h ^ (w >> 24)) * fnvPrime
-	return h
+// hashSquare returns the keys for every piece on `i`.
+func (p *Position) hashSquare(i uint) uint64 {
+	return p.hashSquareAt(i, i)
 }
 
-func (p *Position) hashAt(i uint) uint64 {
-	if p.Height[i] <= 1 {
+// hashSquareAt returns the keys the stack on `i` would have if it
+// stood on square `at` instead; it lets Canonical hash symmetric
+// positions without building them.
+func (p *Position) hashSquareAt(i, at uint) uint64 {
+	h := uint(p.Height[i])
+	if h == 0 {
 		return 0
 	}
-	return hash64(hash8(basis[i], p.Height[i]), p.Stacks[i])
+	var c uint
+	if p.Black&(1<<i) != 0 {
+		c = 1
+	}
+	k := zobrist.piece[at][h-1][c]
+	switch {
+	case p.Standing&(1<<i) != 0:
+		k ^= zobrist.standing[at]
+	case p.Caps&(1<<i) != 0:
+		k ^= zobrist.capstone[at]
+	}
+	for j := uint(1); j < h; j++ {
+		k ^= zobrist.piece[at][h-1-j][p.buried(i, j)]
+	}
+	return k
 }
 
-func (p *Position) Hash() uint64 {
-	h := p.hash
-	h = hash64(h, p.White)
-	h = hash64(h, p.Black)
-	h = hash64(h, p.Standing)
-	h = hash64(h, p.Caps)
-	h = hash8(h, byte(p.ToMove()))
+// computeHash computes the hash of `p` from scratch.
+func (p *Position) computeHash() uint64 {
+	h := p.hashReserves()
+	if p.ToMove() == Black {
+		h ^= zobrist.black
+	}
+	for i := range p.Height {
+		h ^= p.hashSquare(uint(i))
+	}
 	return h
 }
+
+func (p *Position) Hash() uint64 {
+	return p.hash
+}
@@ -0,0 +1,110 @@
+package tak
+
+import "errors"
+
+// DefaultRepetitions is the number of times a position must occur
+// for NewGame to declare the game drawn by repetition.
+const DefaultRepetitions = 3
+
+var ErrNoHistory = errors.New("no moves to undo")
+
+// A Game is a sequence of positions together with the moves that
+// connect them. In addition to the rules enforced by Position, a
+// Game adjudicates draws by repetition and by game length.
+type Game struct {
+	// Positions[0] is the starting position, and Positions[i+1]
+	// is the result of playing Moves[i] in Positions[i].
+	Positions []*Position
+	Moves     []Move
+
+	// MaxPlies, if nonzero, draws the game once that many plies
+	// have been played.
+	MaxPlies int
+	// Repetitions, if nonzero, draws the game once the same
+	// position, with the same side to move, has occurred that many
+	// times.
+	Repetitions int
+
+	seen map[uint64]int
+}
+
+// NewGame returns a Game starting at `p` which is drawn by
+// threefold repetition and has no ply limit.
+func NewGame(p *Position) *Game {
+	g := &Game{
+		Positions:   []*Position{p},
+		Repetitions: DefaultRepetitions,
+		seen:        make(map[uint64]int),
+	}
+	g.seen[p.Hash()]++
+	return g
+}
+
+// Position returns the current position.
+func (g *Game) Position() *Position {
+	return g.Positions[len(g.Positions)-1]
+}
+
+// Plies returns the number of plies played since the starting
+// position.
+func (g *Game) Plies() int {
+	return len(g.Moves)
+}
+
+// Occurrences returns the number of times the current position has
+// occurred in the game, including this one.
+func (g *Game) Occurrences() int {
+	return g.seen[g.Position().Hash()]
+}
+
+// Move plays `m` in the current position and returns the resulting
+// position.
+func (g *Game) Move(m *Move) (*Position, error) {
+	next, e := g.Position().Move(m)
+	if e != nil {
+		return nil, e
+	}
+	g.Positions = append(g.Positions, next)
+	g.Moves = append(g.Moves, *m)
+	g.seen[next.Hash()]++
+	return next, nil
+}
+
+// Undo takes back the last move played.
+func (g *Game) Undo() error {
+	if len(g.Moves) == 0 {
+		return ErrNoHistory
+	}
+	h := g.Position().Hash()
+	if g.seen[h]--; g.seen[h] == 0 {
+		delete(g.seen, h)
+	}
+	g.Positions = g.Positions[:len(g.Positions)-1]
+	g.Moves = g.Moves[:len(g.Moves)-1]
+	return nil
+}
+
+// GameOver reports whether the game is over, either in the current
+// position or by one of the draw rules.
+func (g *Game) GameOver() (over bool, winner Color) {
+	d := g.WinDetails()
+	return d.Over, d.Winner
+}
+
+func (g *Game) WinDetails() WinDetails {
+	d := g.Position().WinDetails()
+	if d.Over {
+		return d
+	}
+	switch {
+	case g.Repetitions != 0 && g.Occurrences() >= g.Repetitions:
+		d.Reason = RepetitionDraw
+	case g.MaxPlies != 0 && g.Plies() >= g.MaxPlies:
+		d.Reason = PlyLimitDraw
+	default:
+		return d
+	}
+	d.Over = true
+	d.Winner = NoColor
+	return d
+}
@@ -0,0 +1,81 @@
+package tak
+
+import "testing"
+
+func TestGameRepetition(t *testing.T) {
+	g := NewGame(New(Config{Size: 5}))
+	opening := []Move{
+		{X: 0, Y: 0, Type: PlaceFlat},
+		{X: 4, Y: 4, Type: PlaceFlat},
+	}
+	shuffle := []Move{
+		{X: 4, Y: 4, Type: SlideDown, Slides: []byte{1}},
+		{X: 0, Y: 0, Type: SlideUp, Slides: []byte{1}},
+		{X: 4, Y: 3, Type: SlideUp, Slides: []byte{1}},
+		{X: 0, Y: 1, Type: SlideDown, Slides: []byte{1}},
+	}
+	for _, m := range opening {
+		if _, e := g.Move(&m); e != nil {
+			t.Fatalf("move: %v", e)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		for j, m := range shuffle {
+			if over, _ := g.GameOver(); over {
+				t.Fatalf("game over early at ply=%d", g.Plies())
+			}
+			if _, e := g.Move(&m); e != nil {
+				t.Fatalf("move %d/%d: %v", i, j, e)
+			}
+		}
+	}
+	if n := g.Occurrences(); n != 3 {
+		t.Fatalf("occurrences=%d", n)
+	}
+	d := g.WinDetails()
+	if !d.Over || d.Winner != NoColor || d.Reason != RepetitionDraw {
+		t.Fatalf("details=%#v", d)
+	}
+
+	if e := g.Undo(); e != nil {
+		t.Fatalf("undo: %v", e)
+	}
+	if over, _ := g.GameOver(); over {
+		t.Fatalf("game over after undo")
+	}
+
+	g.Repetitions = 0
+	g.Move(&shuffle[3])
+	if over, _ := g.GameOver(); over {
+		t.Fatalf("repetition with Repetitions=0")
+	}
+}
+
+func TestGamePlyLimit(t *testing.T) {
+	g := NewGame(New(Config{Size: 5}))
+	g.MaxPlies = 3
+	moves := []Move{
+		{X: 0, Y: 0, Type: PlaceFlat},
+		{X: 4, Y: 4, Type: PlaceFlat},
+		{X: 2, Y: 2, Type: PlaceFlat},
+	}
+	for _, m := range moves {
+		if over, _ := g.GameOver(); over {
+			t.Fatalf("game over early at ply=%d", g.Plies())
+		}
+		if _, e := g.Move(&m); e != nil {
+			t.Fatalf("move: %v", e)
+		}
+	}
+	d := g.WinDetails()
+	if !d.Over || d.Winner != NoColor || d.Reason != PlyLimitDraw {
+		t.Fatalf("details=%#v", d)
+	}
+}
+
+func TestGameUndoEmpty(t *testing.T) {
+	g := NewGame(New(Config{Size: 5}))
+	if e := g.Undo(); e != ErrNoHistory {
+		t.Fatalf("undo=%v", e)
+	}
+}
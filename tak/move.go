@@ -74,6 +74,31 @@ func (m *Move) Hash() uint64 {
 	return h
 }
 
+// Pack encodes `m` in 20 bits, for tables that store moves in
+// machine words. Drops are recorded as the cumulative counts at
+// which they end, so the pieces moved may not exceed 8, as they
+// never do in a legal move.
+func (m *Move) Pack() uint32 {
+	var drops uint32
+	n := 0
+	for _, s := range m.Slides {
+		n += int(s)
+		drops |= 1 << uint(n-1)
+	}
+	return uint32(m.X) | uint32(m.Y)<<4 | uint32(m.Type)<<8 | drops<<12
+}
+
+// UnpackMove decodes a move encoded by Pack. It does not allocate;
+// the Slides of the result are shared and must not be modified.
+func UnpackMove(v uint32) Move {
+	return Move{
+		X:      int(v & 0xf),
+		Y:      int(v >> 4 & 0xf),
+		Type:   MoveType(v >> 8 & 0xf),
+		Slides: packedSlides[v>>12&0xff],
+	}
+}
+
 var (
 	ErrOccupied       = errors.New("position is occupied")
 	ErrIllegalSlide   = errors.New("illegal slide")
@@ -91,19 +116,120 @@ func (p *Position) MovePreallocated(m *Move, next *Position) (*Position, error)
 	} else {
 		copyPosition(p, next)
 	}
-	next.move++
+	if e := next.apply(m); e != nil {
+		return nil, e
+	}
+	return next, nil
+}
+
+// An Undo records the parts of a Position overwritten by DoMove,
+// so that UndoMove can restore them.
+type Undo struct {
+	white, black, standing, caps uint64
+
+	whiteStones, whiteCaps byte
+	blackStones, blackCaps byte
+
+	hash uint64
+	// analysis is a copy of the position's groups, which are
+	// cheaper to restore than to recompute.
+	analysis Analysis
+
+	n       int
+	squares [9]struct {
+		i      uint
+		height uint8
+		stack  uint64
+		deep   uint64
+	}
+}
+
+func (u *Undo) save(p *Position, m *Move) {
+	u.white, u.black = p.White, p.Black
+	u.standing, u.caps = p.Standing, p.Caps
+	u.whiteStones, u.whiteCaps = p.whiteStones, p.whiteCaps
+	u.blackStones, u.blackCaps = p.blackStones, p.blackCaps
+	u.hash = p.hash
+	copyAnalysis(&u.analysis, &p.analysis, u.analysis.WhiteGroups[:0])
+	u.n = 0
+
+	dx, dy, n := 0, 0, 0
+	switch m.Type {
+	case PlaceFlat, PlaceStanding, PlaceCapstone:
+	case SlideLeft:
+		dx, n = -1, len(m.Slides)
+	case SlideRight:
+		dx, n = 1, len(m.Slides)
+	case SlideUp:
+		dy, n = 1, len(m.Slides)
+	case SlideDown:
+		dy, n = -1, len(m.Slides)
+	default:
+		return
+	}
+	x, y := m.X, m.Y
+	for j := 0; j <= n && j < len(u.squares); j++ {
+		if x < 0 || x >= p.cfg.Size || y < 0 || y >= p.cfg.Size {
+			break
+		}
+		i := uint(x + y*p.cfg.Size)
+		u.squares[u.n].i = i
+		u.squares[u.n].height = p.Height[i]
+		u.squares[u.n].stack = p.Stacks[i]
+		u.squares[u.n].deep = p.deep[i]
+		u.n++
+		x += dx
+		y += dy
+	}
+}
+
+// DoMove applies `m` to `p` in place, recording the information
+// needed to reverse it in `u`. If the move is illegal, `p` is left
+// unchanged and an error is returned.
+func (p *Position) DoMove(m *Move, u *Undo) error {
+	u.save(p, m)
+	if e := p.apply(m); e != nil {
+		p.UndoMove(u)
+		return e
+	}
+	return nil
+}
+
+// UndoMove reverses the most recent DoMove, which must have been
+// passed `u`.
+func (p *Position) UndoMove(u *Undo) {
+	p.move--
+	p.White, p.Black = u.white, u.black
+	p.Standing, p.Caps = u.standing, u.caps
+	p.whiteStones, p.whiteCaps = u.whiteStones, u.whiteCaps
+	p.blackStones, p.blackCaps = u.blackStones, u.blackCaps
+	p.hash = u.hash
+	for j := 0; j < u.n; j++ {
+		sq := &u.squares[j]
+		p.Height[sq.i] = sq.height
+		p.Stacks[sq.i] = sq.stack
+		p.deep[sq.i] = sq.deep
+	}
+	copyAnalysis(&p.analysis, &u.analysis, p.analysis.WhiteGroups[:0])
+}
+
+func (p *Position) apply(m *Move) error {
+	toMove := p.ToMove()
+	opening := p.move < 2
+	p.move++
+	p.hash ^= zobrist.black
 	var place Piece
 	dx, dy := 0, 0
 	switch m.Type {
 	case Pass:
-		next.analyze()
-		return next, nil
+		p.analyze()
+		return nil
 	case PlaceFlat:
-		place = MakePiece(p.ToMove(), Flat)
+		place = MakePiece(toMove, Flat)
 	case PlaceStanding:
-		place = MakePiece(p.ToMove(), Standing)
+		place = MakePiece(toMove, Standing)
 	case PlaceCapstone:
-		place = MakePiece(p.ToMove(), Capstone)
+		place = MakePiece(toMove, Capstone)
 	case SlideLeft:
 		dx = -1
 	case SlideRight:
@@ -113,51 +239,56 @@ func (p *Position) MovePreallocated(m *Move, next *Position) (*Position, error)
 	case SlideDown:
 		dy = -1
 	default:
-		return nil, errors.New("invalid move type")
+		return errors.New("invalid move type")
 	}
-	if p.move < 2 {
+	if opening {
 		if place.Kind() != Flat {
-			return nil, ErrIllegalOpening
+			return ErrIllegalOpening
 		}
 		place = MakePiece(place.Color().Flip(), place.Kind())
 	}
 	i := uint(m.X + m.Y*p.Size())
 	if place != 0 {
 		if (p.White|p.Black)&(1<<i) != 0 {
-			return nil, ErrOccupied
+			return ErrOccupied
 		}
 
 		var stones *byte
 		switch place.Kind() {
 		case Capstone:
-			if p.ToMove() == Black {
-				stones = &next.blackCaps
+			if toMove == Black {
+				stones = &p.blackCaps
 			} else {
-				stones = &next.whiteCaps
+				stones = &p.whiteCaps
 			}
-			next.Caps |= (1 << i)
+			p.Caps |= (1 << i)
 		case Standing:
-			next.Standing |= (1 << i)
+			p.Standing |= (1 << i)
 			fallthrough
 		case Flat:
 			if place.Color() == Black {
-				stones = &next.blackStones
+				stones = &p.blackStones
 			} else {
-				stones = &next.whiteStones
+				stones = &p.whiteStones
 			}
 		}
 		if *stones <= 0 {
-			return nil, ErrNoCapstone
+			return ErrNoCapstone
 		}
+		p.hash ^= p.hashReserves()
 		*stones--
+		p.hash ^= p.hashReserves()
 		if place.Color() == White {
-			next.White |= (1 << i)
+			p.White |= (1 << i)
+			p.hash ^= zobrist.piece[i][0][0]
 		} else {
-			next.Black |= (1 << i)
+			p.Black |= (1 << i)
+			p.hash ^= zobrist.piece[i][0][1]
 		}
-		next.Height[i]++
-		next.analyze()
-		return next, nil
+		p.hash ^= p.hashKind(i)
+		p.Height[i]++
+		p.analyze()
+		return nil
 	}
 
 	ct := uint(0)
@@ -165,13 +296,13 @@ func (p *Position) MovePreallocated(m *Move, next *Position) (*Position, error)
 		ct += uint(c)
 	}
 	if ct > uint(p.cfg.Size) || ct < 1 || ct > uint(p.Height[i]) {
-		return nil, ErrIllegalSlide
+		return ErrIllegalSlide
 	}
-	if p.ToMove() == White && p.White&(1<<i) == 0 {
-		return nil, ErrIllegalSlide
+	if toMove == White && p.White&(1<<i) == 0 {
+		return ErrIllegalSlide
 	}
-	if p.ToMove() == Black && p.Black&(1<<i) == 0 {
-		return nil, ErrIllegalSlide
+	if toMove == Black && p.Black&(1<<i) == 0 {
+		return ErrIllegalSlide
 	}
 
 	top := p.Top(m.X, m.Y)
@@ -180,85 +311,120 @@ func (p *Position) MovePreallocated(m *Move, next *Position) (*Position, error)
 		stack |= 1
 	}
 
-	next.Caps &= ^(1 << i)
-	next.Standing &= ^(1 << i)
-	if uint(next.Height[i]) == ct {
-		next.White &= ^(1 << i)
-		next.Black &= ^(1 << i)
+	p.hash ^= p.hashKind(i)
+	for j := uint(0); j < ct; j++ {
+		p.hash ^= zobrist.piece[i][uint(p.Height[i])-1-j][(stack>>j)&1]
+	}
+	p.Caps &= ^(1 << i)
+	p.Standing &= ^(1 << i)
+	if uint(p.Height[i]) == ct {
+		p.White &= ^(1 << i)
+		p.Black &= ^(1 << i)
 	} else {
 		if stack&(1<<ct) == 0 {
-			next.White |= (1 << i)
-			next.Black &= ^(1 << i)
+			p.White |= (1 << i)
+			p.Black &= ^(1 << i)
 		} else {
-			next.Black |= (1 << i)
-			next.White &= ^(1 << i)
+			p.Black |= (1 << i)
+			p.White &= ^(1 << i)
 		}
 	}
-	next.hash ^= next.hashAt(i)
-	next.Stacks[i] >>= ct
-	next.Height[i] -= uint8(ct)
-	next.hash ^= next.hashAt(i)
+	p.Stacks[i] = p.Stacks[i]>>ct | p.deep[i]<<(64-ct)
+	p.deep[i] >>= ct
+	p.Height[i] -= uint8(ct)
 
 	x, y := m.X, m.Y
 	for _, c := range m.Slides {
 		x += dx
 		y += dy
-		if x < 0 || x >= next.cfg.Size ||
-			y < 0 || y >= next.cfg.Size {
-			return nil, ErrIllegalSlide
+		if x < 0 || x >= p.cfg.Size ||
+			y < 0 || y >= p.cfg.Size {
+			return ErrIllegalSlide
 		}
 		if int(c) < 1 || uint(c) > ct {
-			return nil, ErrIllegalSlide
+			return ErrIllegalSlide
 		}
 		i = uint(x + y*p.Size())
 		switch {
-		case next.Caps&(1<<i) != 0:
-			return nil, ErrIllegalSlide
-		case next.Standing&(1<<i) != 0:
-			if ct != 1 || top.Kind() != Capstone {
-				return nil, ErrIllegalSlide
+		case p.Caps&(1<<i) != 0:
+			return ErrIllegalSlide
+		case p.Standing&(1<<i) != 0:
+			if ct != 1 || top.Kind() != Capstone || p.cfg.NoCapstoneFlatten {
+				return ErrIllegalSlide
 			}
-			next.Standing &= ^(1 << i)
+			p.Standing &= ^(1 << i)
+			p.hash ^= zobrist.standing[i]
+		}
+		for j := uint(0); j < uint(c); j++ {
+			p.hash ^= zobrist.piece[i][uint(p.Height[i])+j][(stack>>(ct-1-j))&1]
 		}
-		next.hash ^= next.hashAt(i)
-		if next.White&(1<<i) != 0 {
-			next.Stacks[i] <<= 1
-		} else if next.Black&(1<<i) != 0 {
-			next.Stacks[i] <<= 1
-			next.Stacks[i] |= 1
+		if p.White&(1<<i) != 0 {
+			p.deep[i] = p.deep[i]<<1 | p.Stacks[i]>>63
+			p.Stacks[i] <<= 1
+		} else if p.Black&(1<<i) != 0 {
+			p.deep[i] = p.deep[i]<<1 | p.Stacks[i]>>63
+			p.Stacks[i] <<= 1
+			p.Stacks[i] |= 1
 		}
 		drop := (stack >> (ct - uint(c-1))) & ((1 << (c - 1)) - 1)
-		next.Stacks[i] = next.Stacks[i]<<(c-1) | drop
-		next.Height[i] += c
-		next.hash ^= next.hashAt(i)
+		p.deep[i] = p.deep[i]<<(c-1) | p.Stacks[i]>>(65-c)
+		p.Stacks[i] = p.Stacks[i]<<(c-1) | drop
+		p.Height[i] += c
 		if stack&(1<<(ct-uint(c))) != 0 {
-			next.Black |= (1 << i)
-			next.White &= ^(1 << i)
+			p.Black |= (1 << i)
+			p.White &= ^(1 << i)
 		} else {
-			next.Black &= ^(1 << i)
-			next.White |= (1 << i)
+			p.Black &= ^(1 << i)
+			p.White |= (1 << i)
 		}
 		ct -= uint(c)
 		if ct == 0 {
 			switch top.Kind() {
 			case Capstone:
-				next.Caps |= (1 << i)
+				p.Caps |= (1 << i)
 			case Standing:
-				next.Standing |= (1 << i)
+				p.Standing |= (1 << i)
 			}
+			p.hash ^= p.hashKind(i)
 		}
 	}
 
-	next.analyze()
-	return next, nil
+	p.analyze()
+	return nil
 }
 
 var slides [][][]byte
 
+// slideCounts[h][n] is the number of slides in slides[h] that
+// cover n squares, and smashCounts[h][n] the number of those that
+// drop a single piece on the last square.
+var slideCounts, smashCounts [9][9]int
+
 func init() {
 	slides = make([][][]byte, 10)
 	for s := 1; s <= 8; s++ {
 		slides[s] = calculateSlides(s)
+		for _, sl := range slides[s] {
+			slideCounts[s][len(sl)]++
+			if sl[len(sl)-1] == 1 {
+				smashCounts[s][len(sl)]++
+			}
+		}
+	}
+}
+
+// packedSlides[d] are the drops Move.Pack encodes as `d`.
+var packedSlides [256][]byte
+
+func init() {
+	for d := 1; d < len(packedSlides); d++ {
+		last := 0
+		for i := 0; i < 8; i++ {
+			if d&(1<<uint(i)) != 0 {
+				packedSlides[d] = append(packedSlides[d], byte(i+1-last))
+				last = i + 1
+			}
+		}
 	}
 }
 
@@ -276,6 +442,9 @@ func calculateSlides(stack int) [][]byte {
 	return out
 }
 
+// AllMoves appends the pseudo-legal moves in `p` to `moves`. It is
+// cheaper than LegalMoves, but the moves it returns may still be
+// rejected by Move, so callers must check for errors.
 func (p *Position) AllMoves(moves []Move) []Move {
 	next := p.ToMove()
 	cap := false
@@ -332,3 +501,148 @@ func (p *Position) AllMoves(moves []Move) []Move {
 
 	return moves
 }
+
+// LegalMoves appends every legal move in `p` to `moves`. Every move
+// it returns will be accepted by Move.
+func (p *Position) LegalMoves(moves []Move) []Move {
+	next := p.ToMove()
+	stones, caps := p.reserves(next)
+	if p.move < 2 {
+		stones, _ = p.reserves(next.Flip())
+		caps = 0
+	}
+	for x := 0; x < p.cfg.Size; x++ {
+		for y := 0; y < p.cfg.Size; y++ {
+			i := uint(y*p.cfg.Size + x)
+			if p.Height[i] == 0 {
+				if stones > 0 {
+					moves = append(moves, Move{x, y, PlaceFlat, nil})
+					if p.move >= 2 {
+						moves = append(moves, Move{x, y, PlaceStanding, nil})
+					}
+				}
+				if caps > 0 {
+					moves = append(moves, Move{x, y, PlaceCapstone, nil})
+				}
+				continue
+			}
+			if !p.canMove(next, i) {
+				continue
+			}
+			h := p.Height[i]
+			if h > uint8(p.cfg.Size) {
+				h = uint8(p.cfg.Size)
+			}
+			for _, d := range [...]MoveType{SlideLeft, SlideRight, SlideDown, SlideUp} {
+				reach, smash := p.slideReach(x, y, d)
+				for _, s := range slides[h] {
+					if len(s) <= reach ||
+						(smash && len(s) == reach+1 && s[reach] == 1) {
+						moves = append(moves, Move{x, y, d, s})
+					}
+				}
+			}
+		}
+	}
+	return moves
+}
+
+// CountLegalMoves returns the number of moves LegalMoves would
+// return, without generating them.
+func (p *Position) CountLegalMoves() int {
+	next := p.ToMove()
+	stones, caps := p.reserves(next)
+	if p.move < 2 {
+		stones, _ = p.reserves(next.Flip())
+		caps = 0
+	}
+	perEmpty := 0
+	if stones > 0 {
+		perEmpty++
+		if p.move >= 2 {
+			perEmpty++
+		}
+	}
+	if caps > 0 {
+		perEmpty++
+	}
+	n := 0
+	for x := 0; x < p.cfg.Size; x++ {
+		for y := 0; y < p.cfg.Size; y++ {
+			i := uint(y*p.cfg.Size + x)
+			if p.Height[i] == 0 {
+				n += perEmpty
+				continue
+			}
+			if !p.canMove(next, i) {
+				continue
+			}
+			h := p.Height[i]
+			if h > uint8(p.cfg.Size) {
+				h = uint8(p.cfg.Size)
+			}
+			for _, d := range [...]MoveType{SlideLeft, SlideRight, SlideDown, SlideUp} {
+				reach, smash := p.slideReach(x, y, d)
+				for l := 1; l <= reach && l <= int(h); l++ {
+					n += slideCounts[h][l]
+				}
+				if smash && reach < int(h) {
+					n += smashCounts[h][reach+1]
+				}
+			}
+		}
+	}
+	return n
+}
+
+func (p *Position) reserves(c Color) (stones, caps byte) {
+	if c == White {
+		return p.whiteStones, p.whiteCaps
+	}
+	return p.blackStones, p.blackCaps
+}
+
+// canMove reports whether `c` may move the stack on square `i`.
+func (p *Position) canMove(c Color, i uint) bool {
+	if p.move < 2 {
+		return false
+	}
+	if c == White {
+		return p.White&(1<<i) != 0
+	}
+	return p.Black&(1<<i) != 0
+}
+
+// slideReach returns the number of squares a stack at (x, y) can
+// slide in direction `d` before reaching the edge of the board or a
+// wall or capstone, and whether a capstone on top of the stack could
+// flatten a wall just beyond that.
+func (p *Position) slideReach(x, y int, d MoveType) (reach int, smash bool) {
+	capTop := p.Caps&(1<<uint(y*p.cfg.Size+x)) != 0 && !p.cfg.NoCapstoneFlatten
+	dx, dy := 0, 0
+	switch d {
+	case SlideLeft:
+		dx = -1
+	case SlideRight:
+		dx = 1
+	case SlideDown:
+		dy = -1
+	case SlideUp:
+		dy = 1
+	}
+	for {
+		x += dx
+		y += dy
+		if x < 0 || x >= p.cfg.Size || y < 0 || y >= p.cfg.Size {
+			return reach, false
+		}
+		i := uint(y*p.cfg.Size + x)
+		if p.Caps&(1<<i) != 0 {
+			return reach, false
+		}
+		if p.Standing&(1<<i) != 0 {
+			return reach, capTop
+		}
+		reach++
+	}
+}
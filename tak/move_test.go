@@ -1,6 +1,7 @@
 package tak
 
 import (
+	"math/rand"
 	"reflect"
 	"sort"
 	"testing"
@@ -265,3 +266,242 @@ func TestEqual(t *testing.T) {
 		t.Errorf("%#v = %#v!", a, b)
 	}
 }
+
+func positionsEqual(a, b *Position) bool {
+	if a.White != b.White || a.Black != b.Black ||
+		a.Standing != b.Standing || a.Caps != b.Caps {
+		return false
+	}
+	if a.move != b.move || a.hash != b.hash {
+		return false
+	}
+	if a.whiteStones != b.whiteStones || a.whiteCaps != b.whiteCaps ||
+		a.blackStones != b.blackStones || a.blackCaps != b.blackCaps {
+		return false
+	}
+	if !groupsEqual(a.analysis.WhiteGroups, b.analysis.WhiteGroups) ||
+		!groupsEqual(a.analysis.BlackGroups, b.analysis.BlackGroups) {
+		return false
+	}
+	return reflect.DeepEqual(a.Height, b.Height) &&
+		reflect.DeepEqual(a.Stacks, b.Stacks) &&
+		reflect.DeepEqual(a.deep, b.deep)
+}
+
+func groupsEqual(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDoUndoMove(t *testing.T) {
+	r := rand.New(rand.NewSource(17))
+	for _, size := range []int{3, 4, 5, 6, 7, 8} {
+		p := New(Config{Size: size})
+		var u Undo
+		for ply := 0; ply < 200; ply++ {
+			if over, _ := p.GameOver(); over {
+				break
+			}
+			orig := p.Clone()
+			moves := p.AllMoves(nil)
+			var legal []Move
+			for _, m := range moves {
+				want, ewant := orig.Move(&m)
+				e := p.DoMove(&m, &u)
+				if (e == nil) != (ewant == nil) {
+					t.Fatalf("size=%d ply=%d %#v: DoMove=%v Move=%v",
+						size, ply, m, e, ewant)
+				}
+				if e != nil {
+					if !positionsEqual(p, orig) {
+						t.Fatalf("size=%d ply=%d %#v: failed DoMove mutated position",
+							size, ply, m)
+					}
+					continue
+				}
+				legal = append(legal, m)
+				if !positionsEqual(p, want) {
+					t.Fatalf("size=%d ply=%d %#v: DoMove != Move", size, ply, m)
+				}
+				p.UndoMove(&u)
+				if !positionsEqual(p, orig) {
+					t.Fatalf("size=%d ply=%d %#v: UndoMove did not restore",
+						size, ply, m)
+				}
+			}
+			m := legal[r.Intn(len(legal))]
+			if e := p.DoMove(&m, &u); e != nil {
+				t.Fatalf("size=%d ply=%d: %v", size, ply, e)
+			}
+		}
+	}
+}
+
+func TestTallStacks(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	var pieces []Piece
+	for i := 0; i < 45; i++ {
+		pieces = append(pieces, MakePiece(White, Flat), MakePiece(Black, Flat))
+	}
+	r.Shuffle(len(pieces), func(i, j int) {
+		pieces[i], pieces[j] = pieces[j], pieces[i]
+	})
+	// squares a1 and b1, top first
+	sqs := [2]Square{pieces[:70], pieces[70:]}
+	board := make([][]Square, 8)
+	for i := range board {
+		board[i] = make([]Square, 8)
+	}
+	board[0][0] = append(Square(nil), sqs[0]...)
+	board[0][1] = append(Square(nil), sqs[1]...)
+	p, e := FromSquares(Config{Size: 8}, board, 2)
+	if e != nil {
+		t.Fatalf("FromSquares: %v", e)
+	}
+
+	check := func(ply int) {
+		for x, want := range sqs {
+			if len(want) == 0 {
+				want = nil
+			}
+			if got := p.At(x, 0); !reflect.DeepEqual(got, want) {
+				t.Fatalf("ply=%d square %d: got %v want %v", ply, x, got, want)
+			}
+			var w, b int
+			for j := 1; j < len(want); j++ {
+				if want[j].Color() == White {
+					w++
+				} else {
+					b++
+				}
+			}
+			if cw, cb := p.Captives(x); cw != w || cb != b {
+				t.Fatalf("ply=%d square %d: captives=(%d,%d) want (%d,%d)",
+					ply, x, cw, cb, w, b)
+			}
+		}
+		if h := p.computeHash(); h != p.Hash() {
+			t.Fatalf("ply=%d: hash=%x computed=%x", ply, p.Hash(), h)
+		}
+	}
+	check(0)
+
+	var u Undo
+	tallest := 0
+	for ply := 1; ply <= 500; ply++ {
+		var from int
+		switch {
+		case len(sqs[0]) > 0 && sqs[0][0].Color() == p.ToMove():
+			from = 0
+		case len(sqs[1]) > 0 && sqs[1][0].Color() == p.ToMove():
+			from = 1
+		default:
+			p.IncrementMove()
+			continue
+		}
+		n := 1 + r.Intn(8)
+		if n > len(sqs[from]) {
+			n = len(sqs[from])
+		}
+		m := Move{X: from, Y: 0, Type: SlideRight, Slides: []byte{byte(n)}}
+		if from == 1 {
+			m.Type = SlideLeft
+		}
+		orig := p.Clone()
+		if e := p.DoMove(&m, &u); e != nil {
+			t.Fatalf("ply=%d: %v", ply, e)
+		}
+		p.UndoMove(&u)
+		if !positionsEqual(p, orig) {
+			t.Fatalf("ply=%d: UndoMove did not restore", ply)
+		}
+		if p, e = p.Move(&m); e != nil {
+			t.Fatalf("ply=%d: %v", ply, e)
+		}
+		to := 1 - from
+		moved := append(Square(nil), sqs[from][:n]...)
+		sqs[to] = append(moved, sqs[to]...)
+		sqs[from] = sqs[from][n:]
+		check(ply)
+		if len(sqs[to]) > tallest {
+			tallest = len(sqs[to])
+		}
+	}
+	if tallest <= 65 {
+		t.Fatalf("tallest stack=%d, did not exercise deep stacks", tallest)
+	}
+}
+
+func TestLegalMoves(t *testing.T) {
+	r := rand.New(rand.NewSource(11))
+	for _, size := range []int{3, 4, 5, 6, 7, 8} {
+		for g := 0; g < 10; g++ {
+			p := New(Config{Size: size})
+			for ply := 0; ply < 200; ply++ {
+				var want []Move
+				for _, m := range p.AllMoves(nil) {
+					if _, e := p.Move(&m); e == nil {
+						want = append(want, m)
+					}
+				}
+				got := p.LegalMoves(nil)
+				if len(got) != len(want) {
+					t.Fatalf("size=%d ply=%d: %d legal moves, want %d",
+						size, ply, len(got), len(want))
+				}
+				for i := range got {
+					if !got[i].Equal(&want[i]) {
+						t.Fatalf("size=%d ply=%d: move %d=%#v want %#v",
+							size, ply, i, got[i], want[i])
+					}
+				}
+				if n := p.CountLegalMoves(); n != len(want) {
+					t.Fatalf("size=%d ply=%d: count=%d want %d",
+						size, ply, n, len(want))
+				}
+				if over, _ := p.GameOver(); over || len(got) == 0 {
+					break
+				}
+				m := got[r.Intn(len(got))]
+				p, _ = p.Move(&m)
+			}
+		}
+	}
+}
+
+func TestPackMove(t *testing.T) {
+	p := New(Config{Size: 8})
+	p.move = 2
+	for i := range p.Height {
+		p.White |= 1 << uint(i)
+		p.Height[i] = 8
+		p.Stacks[i] = 0
+	}
+	moves := p.AllMoves(nil)
+	moves = append(moves,
+		Move{X: 7, Y: 7, Type: PlaceCapstone},
+		Move{Type: Pass},
+	)
+	seen := make(map[uint32]bool)
+	for _, m := range moves {
+		v := m.Pack()
+		if seen[v] {
+			t.Fatalf("%+v: duplicate packing %x", m, v)
+		}
+		seen[v] = true
+		if v>>20 != 0 {
+			t.Fatalf("%+v: packed to %x", m, v)
+		}
+		got := UnpackMove(v)
+		if !got.Equal(&m) || len(got.Slides) != len(m.Slides) {
+			t.Fatalf("%+v: unpacked to %+v", m, got)
+		}
+	}
+}
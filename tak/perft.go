@@ -0,0 +1,61 @@
+package tak
+
+// Perft returns the number of move sequences of length `depth`
+// playable from `p`. Positions in which the game is over have no
+// moves, so games ending early contribute nothing. It exists to
+// check the move generator against known counts.
+func Perft(p *Position, depth int) uint64 {
+	if depth == 0 {
+		return 1
+	}
+	p = p.Clone()
+	return perft(p, depth, make([]Undo, depth), make([][]Move, depth))
+}
+
+// A PerftEntry is the perft count below one root move.
+type PerftEntry struct {
+	Move  Move
+	Nodes uint64
+}
+
+// PerftDivide returns, for each legal move in `p`, the perft count
+// of depth `depth-1` below it.
+func PerftDivide(p *Position, depth int) []PerftEntry {
+	if depth == 0 {
+		return nil
+	}
+	if over, _ := p.GameOver(); over {
+		return nil
+	}
+	p = p.Clone()
+	undo := make([]Undo, depth)
+	moves := make([][]Move, depth)
+	var out []PerftEntry
+	for _, m := range p.LegalMoves(nil) {
+		p.DoMove(&m, &undo[0])
+		var n uint64 = 1
+		if depth > 1 {
+			n = perft(p, depth-1, undo[1:], moves[1:])
+		}
+		p.UndoMove(&undo[0])
+		out = append(out, PerftEntry{Move: m, Nodes: n})
+	}
+	return out
+}
+
+func perft(p *Position, depth int, undo []Undo, moves [][]Move) uint64 {
+	if over, _ := p.GameOver(); over {
+		return 0
+	}
+	if depth == 1 {
+		return uint64(p.CountLegalMoves())
+	}
+	moves[0] = p.LegalMoves(moves[0][:0])
+	var n uint64
+	for i := range moves[0] {
+		p.DoMove(&moves[0][i], &undo[0])
+		n += perft(p, depth-1, undo[1:], moves[1:])
+		p.UndoMove(&undo[0])
+	}
+	return n
+}
@@ -0,0 +1,76 @@
+package tak
+
+import "testing"
+
+func TestPerft(t *testing.T) {
+	cases := []struct {
+		size  int
+		nodes []uint64
+	}{
+		{3, []uint64{9, 72, 1200, 17792, 271812}},
+		{4, []uint64{16, 240, 7440, 216464}},
+		{5, []uint64{25, 600, 43320, 2999784}},
+		{6, []uint64{36, 1260, 132720}},
+		{7, []uint64{49, 2352, 339696}},
+		{8, []uint64{64, 4032, 764064}},
+	}
+	for _, tc := range cases {
+		p := New(Config{Size: tc.size})
+		for i, want := range tc.nodes {
+			if got := Perft(p, i+1); got != want {
+				t.Errorf("size=%d perft(%d)=%d want %d",
+					tc.size, i+1, got, want)
+			}
+		}
+	}
+}
+
+// slowPerft counts using AllMoves and Move, independently of
+// LegalMoves and DoMove.
+func slowPerft(p *Position, depth int) uint64 {
+	if depth == 0 {
+		return 1
+	}
+	if over, _ := p.GameOver(); over {
+		return 0
+	}
+	var n uint64
+	for _, m := range p.AllMoves(nil) {
+		if child, e := p.Move(&m); e == nil {
+			n += slowPerft(child, depth-1)
+		}
+	}
+	return n
+}
+
+func TestPerftMidgame(t *testing.T) {
+	p := New(Config{Size: 5})
+	for _, m := range []Move{
+		{X: 0, Y: 0, Type: PlaceFlat},
+		{X: 4, Y: 4, Type: PlaceFlat},
+		{X: 2, Y: 2, Type: PlaceCapstone},
+		{X: 2, Y: 3, Type: PlaceStanding},
+		{X: 2, Y: 1, Type: PlaceFlat},
+		{X: 3, Y: 3, Type: PlaceCapstone},
+		{X: 2, Y: 2, Type: SlideUp, Slides: []byte{1}},
+		{X: 0, Y: 0, Type: SlideRight, Slides: []byte{1}},
+	} {
+		var e error
+		if p, e = p.Move(&m); e != nil {
+			t.Fatalf("move %#v: %v", m, e)
+		}
+	}
+	for depth := 1; depth <= 3; depth++ {
+		want := slowPerft(p, depth)
+		if got := Perft(p, depth); got != want {
+			t.Errorf("perft(%d)=%d want %d", depth, got, want)
+		}
+		var sum uint64
+		for _, e := range PerftDivide(p, depth) {
+			sum += e.Nodes
+		}
+		if sum != want {
+			t.Errorf("divide(%d) sums to %d want %d", depth, sum, want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package tak
+
+import "../bitboard"
+
+// An Edge is one side of the board. Files run from a (x=0) on the
+// left to the right, and ranks from 1 (y=0) at the bottom to the
+// top, as in PTN.
+type Edge byte
+
+const (
+	EdgeLeft Edge = 1 << iota
+	EdgeRight
+	EdgeBottom
+	EdgeTop
+)
+
+func (e Edge) String() string {
+	switch e {
+	case EdgeLeft | EdgeRight:
+		return "left-right"
+	case EdgeBottom | EdgeTop:
+		return "bottom-top"
+	case EdgeLeft:
+		return "left"
+	case EdgeRight:
+		return "right"
+	case EdgeBottom:
+		return "bottom"
+	case EdgeTop:
+		return "top"
+	}
+	return "?"
+}
+
+// A Coord names a single square on the board.
+type Coord struct {
+	X, Y int
+}
+
+// A Road is a chain of road pieces joining two opposite edges of
+// the board. A group that spans the board in both directions is
+// reported as two Roads.
+type Road struct {
+	Color Color
+	// Edges is the pair of opposite edges the road joins, either
+	// EdgeLeft|EdgeRight or EdgeBottom|EdgeTop.
+	Edges Edge
+	// Group is the bitboard of the whole connected group the road
+	// runs through.
+	Group uint64
+	// Path is a shortest chain of adjacent squares within Group,
+	// running from the left or bottom edge to the opposite one.
+	Path []Coord
+	// Winning is set on the roads of the player who won the game;
+	// if both players complete a road with one move, the player
+	// who moved wins.
+	Winning bool
+}
+
+// Roads returns every road on the board, the winner's first. It
+// returns nil if neither player has a road.
+func (p *Position) Roads() []Road {
+	winner, ok := p.hasRoad()
+	if !ok {
+		return nil
+	}
+	c := &p.cfg.c
+	// bitboard.Constants names edges by bit order, which runs
+	// opposite to the files: the a-file is c.R.
+	spans := []struct {
+		edges    Edge
+		from, to uint64
+	}{
+		{EdgeLeft | EdgeRight, c.R, c.L},
+		{EdgeBottom | EdgeTop, c.B, c.T},
+	}
+	var out []Road
+	for _, color := range []Color{winner, winner.Flip()} {
+		groups := p.analysis.WhiteGroups
+		if color == Black {
+			groups = p.analysis.BlackGroups
+		}
+		for _, g := range groups {
+			for _, s := range spans {
+				if g&s.from == 0 || g&s.to == 0 {
+					continue
+				}
+				out = append(out, Road{
+					Color:   color,
+					Edges:   s.edges,
+					Group:   g,
+					Path:    p.roadPath(g, s.from, s.to),
+					Winning: color == winner,
+				})
+			}
+		}
+	}
+	return out
+}
+
+// roadPath finds a shortest path through `group` from a square in
+// `from` to one in `to`, by breadth-first flooding one layer at a
+// time and then walking back through the layers.
+func (p *Position) roadPath(group, from, to uint64) []Coord {
+	c := &p.cfg.c
+	layers := []uint64{group & from}
+	seen := layers[0]
+	for seen&to == 0 {
+		next := bitboard.Grow(c, group, seen) &^ seen
+		if next == 0 {
+			return nil
+		}
+		layers = append(layers, next)
+		seen |= next
+	}
+	path := make([]Coord, len(layers))
+	cur := lowBit(layers[len(layers)-1] & to)
+	for i := len(layers) - 1; ; i-- {
+		path[i] = p.coord(cur)
+		if i == 0 {
+			break
+		}
+		cur = lowBit(bitboard.Grow(c, layers[i-1], cur))
+	}
+	return path
+}
+
+func lowBit(x uint64) uint64 {
+	return x & -x
+}
+
+func (p *Position) coord(bit uint64) Coord {
+	i := bitIndex(bit)
+	return Coord{X: i % p.Size(), Y: i / p.Size()}
+}
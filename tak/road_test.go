@@ -0,0 +1,97 @@
+package tak
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRoadPath(t *testing.T) {
+	p := New(Config{Size: 5})
+	// a road up the c-file with a detour through b3, plus a
+	// dead-end spur off c2
+	for _, c := range []Coord{
+		{2, 0}, {2, 1}, {1, 1}, {1, 2}, {1, 3}, {2, 3}, {2, 4},
+		{3, 1}, {4, 1},
+	} {
+		set(p, c.X, c.Y, Square{MakePiece(Black, Flat)})
+	}
+	p.move = 1
+	p.analyze()
+
+	d := p.WinDetails()
+	if !d.Over || d.Winner != Black || d.Reason != RoadWin {
+		t.Fatalf("details=%#v", d)
+	}
+	if len(d.Roads) != 1 {
+		t.Fatalf("roads=%#v", d.Roads)
+	}
+	r := d.Roads[0]
+	if r.Color != Black || r.Edges != EdgeBottom|EdgeTop || !r.Winning {
+		t.Errorf("road=%#v", r)
+	}
+	want := []Coord{{2, 0}, {2, 1}, {1, 1}, {1, 2}, {1, 3}, {2, 3}, {2, 4}}
+	if !reflect.DeepEqual(r.Path, want) {
+		t.Errorf("path=%v want=%v", r.Path, want)
+	}
+	if r.Group&(1<<(1*5+4)) == 0 {
+		t.Errorf("group missing spur: %x", r.Group)
+	}
+}
+
+func TestRoadBothDirections(t *testing.T) {
+	p := New(Config{Size: 5})
+	for i := 0; i < 5; i++ {
+		set(p, i, 2, Square{MakePiece(White, Flat)})
+		set(p, 2, i, Square{MakePiece(White, Flat)})
+	}
+	p.move = 2
+	p.analyze()
+
+	roads := p.Roads()
+	if len(roads) != 2 {
+		t.Fatalf("roads=%#v", roads)
+	}
+	if roads[0].Edges != EdgeLeft|EdgeRight || len(roads[0].Path) != 5 ||
+		roads[0].Path[0] != (Coord{0, 2}) {
+		t.Errorf("horizontal=%#v", roads[0])
+	}
+	if roads[1].Edges != EdgeBottom|EdgeTop || len(roads[1].Path) != 5 ||
+		roads[1].Path[0] != (Coord{2, 0}) {
+		t.Errorf("vertical=%#v", roads[1])
+	}
+}
+
+func TestDoubleRoad(t *testing.T) {
+	p := New(Config{Size: 5})
+	for x := 0; x < 5; x++ {
+		set(p, x, 0, Square{MakePiece(White, Flat)})
+		set(p, x, 4, Square{MakePiece(Black, Flat)})
+	}
+	// white to move, so black made the last move and wins
+	p.move = 10
+	p.analyze()
+
+	d := p.WinDetails()
+	if d.Winner != Black || d.Reason != RoadWin {
+		t.Fatalf("details=%#v", d)
+	}
+	if len(d.Roads) != 2 {
+		t.Fatalf("roads=%#v", d.Roads)
+	}
+	if d.Roads[0].Color != Black || !d.Roads[0].Winning {
+		t.Errorf("winning road=%#v", d.Roads[0])
+	}
+	if d.Roads[1].Color != White || d.Roads[1].Winning {
+		t.Errorf("losing road=%#v", d.Roads[1])
+	}
+}
+
+func TestNoRoads(t *testing.T) {
+	p := New(Config{Size: 5})
+	if r := p.Roads(); r != nil {
+		t.Errorf("roads=%#v", r)
+	}
+	if d := p.WinDetails(); d.Roads != nil {
+		t.Errorf("details=%#v", d)
+	}
+}
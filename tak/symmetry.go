@@ -0,0 +1,163 @@
+package tak
+
+// A Symmetry is one of the eight rotations and reflections of the
+// board. Rotations are clockwise as the board is usually drawn, with
+// rank 1 at the bottom.
+type Symmetry byte
+
+const (
+	Identity Symmetry = iota
+	Rotate90
+	Rotate180
+	Rotate270
+	// FlipX mirrors the files, exchanging a and the last file.
+	FlipX
+	// FlipY mirrors the ranks, exchanging 1 and the last rank.
+	FlipY
+	// Transpose reflects across the a1 diagonal.
+	Transpose
+	// AntiTranspose reflects across the other diagonal.
+	AntiTranspose
+
+	NumSymmetries = 8
+)
+
+func (s Symmetry) String() string {
+	switch s {
+	case Identity:
+		return "identity"
+	case Rotate90:
+		return "rotate90"
+	case Rotate180:
+		return "rotate180"
+	case Rotate270:
+		return "rotate270"
+	case FlipX:
+		return "flipx"
+	case FlipY:
+		return "flipy"
+	case Transpose:
+		return "transpose"
+	case AntiTranspose:
+		return "antitranspose"
+	}
+	return "?"
+}
+
+// Inverse returns the symmetry that undoes `s`.
+func (s Symmetry) Inverse() Symmetry {
+	switch s {
+	case Rotate90:
+		return Rotate270
+	case Rotate270:
+		return Rotate90
+	}
+	return s
+}
+
+// Apply maps the square (x, y) on a board of the given size to its
+// image under `s`.
+func (s Symmetry) Apply(size, x, y int) (int, int) {
+	n := size - 1
+	switch s {
+	case Rotate90:
+		return y, n - x
+	case Rotate180:
+		return n - x, n - y
+	case Rotate270:
+		return n - y, x
+	case FlipX:
+		return n - x, y
+	case FlipY:
+		return x, n - y
+	case Transpose:
+		return y, x
+	case AntiTranspose:
+		return n - y, n - x
+	}
+	return x, y
+}
+
+func (s Symmetry) index(size int, i uint) uint {
+	x, y := s.Apply(size, int(i)%size, int(i)/size)
+	return uint(x + y*size)
+}
+
+// Transform returns the image of `m` under `s` on a board of the
+// given size.
+func (m *Move) Transform(size int, s Symmetry) Move {
+	out := *m
+	out.X, out.Y = s.Apply(size, m.X, m.Y)
+	var dx, dy int
+	switch m.Type {
+	case SlideLeft:
+		dx = -1
+	case SlideRight:
+		dx = 1
+	case SlideUp:
+		dy = 1
+	case SlideDown:
+		dy = -1
+	default:
+		return out
+	}
+	// directions transform like the difference of two squares
+	tx, ty := s.Apply(size, m.X+dx, m.Y+dy)
+	switch {
+	case tx < out.X:
+		out.Type = SlideLeft
+	case tx > out.X:
+		out.Type = SlideRight
+	case ty > out.Y:
+		out.Type = SlideUp
+	default:
+		out.Type = SlideDown
+	}
+	return out
+}
+
+// Transform returns a new Position that is the image of `p` under
+// `s`.
+func (p *Position) Transform(s Symmetry) *Position {
+	out := alloc(p)
+	out.White, out.Black, out.Standing, out.Caps = 0, 0, 0, 0
+	size := p.Size()
+	for i := range p.Height {
+		src := uint(i)
+		dst := s.index(size, src)
+		out.Height[dst] = p.Height[src]
+		out.Stacks[dst] = p.Stacks[src]
+		out.deep[dst] = p.deep[src]
+		out.White |= ((p.White >> src) & 1) << dst
+		out.Black |= ((p.Black >> src) & 1) << dst
+		out.Standing |= ((p.Standing >> src) & 1) << dst
+		out.Caps |= ((p.Caps >> src) & 1) << dst
+	}
+	out.hash = out.computeHash()
+	out.analyze()
+	return out
+}
+
+// Canonical returns the smallest hash among the images of `p` under
+// the eight symmetries, and the symmetry that produces it. Symmetric
+// positions share a canonical hash; p.Transform(sym) is the
+// canonical position, and moves found there map back to `p` with
+// sym.Inverse().
+func (p *Position) Canonical() (hash uint64, sym Symmetry) {
+	base := p.hashReserves()
+	if p.ToMove() == Black {
+		base ^= zobrist.black
+	}
+	size := p.Size()
+	hash, sym = p.hash, Identity
+	for s := Rotate90; s < NumSymmetries; s++ {
+		h := base
+		for i := range p.Height {
+			h ^= p.hashSquareAt(uint(i), s.index(size, uint(i)))
+		}
+		if h < hash {
+			hash, sym = h, s
+		}
+	}
+	return hash, sym
+}
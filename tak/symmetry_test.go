@@ -0,0 +1,109 @@
+package tak
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestSymmetryApply(t *testing.T) {
+	cases := []struct {
+		s    Symmetry
+		x, y int
+	}{
+		{Identity, 1, 0},
+		{Rotate90, 0, 3},
+		{Rotate180, 3, 4},
+		{Rotate270, 4, 1},
+		{FlipX, 3, 0},
+		{FlipY, 1, 4},
+		{Transpose, 0, 1},
+		{AntiTranspose, 4, 3},
+	}
+	for _, tc := range cases {
+		x, y := tc.s.Apply(5, 1, 0)
+		if x != tc.x || y != tc.y {
+			t.Errorf("%s(1,0)=(%d,%d) want (%d,%d)", tc.s, x, y, tc.x, tc.y)
+		}
+		x, y = tc.s.Inverse().Apply(5, x, y)
+		if x != 1 || y != 0 {
+			t.Errorf("%s inverse=(%d,%d)", tc.s, x, y)
+		}
+	}
+}
+
+func randomPosition(r *rand.Rand, size, plies int) *Position {
+	p := New(Config{Size: size})
+	for i := 0; i < plies; i++ {
+		moves := p.LegalMoves(nil)
+		next, e := p.Move(&moves[r.Intn(len(moves))])
+		if e != nil {
+			panic(e)
+		}
+		if over, _ := next.GameOver(); over {
+			break
+		}
+		p = next
+	}
+	return p
+}
+
+func squares(p *Position) [][]Square {
+	var out [][]Square
+	for y := 0; y < p.Size(); y++ {
+		var row []Square
+		for x := 0; x < p.Size(); x++ {
+			row = append(row, p.At(x, y))
+		}
+		out = append(out, row)
+	}
+	return out
+}
+
+func TestTransform(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+	for trial := 0; trial < 20; trial++ {
+		size := 3 + trial%6
+		p := randomPosition(r, size, 30)
+		canon, _ := p.Canonical()
+		for s := Identity; s < NumSymmetries; s++ {
+			q := p.Transform(s)
+			if q.Hash() != q.computeHash() {
+				t.Fatalf("size=%d %s: stale hash", size, s)
+			}
+			for y := 0; y < size; y++ {
+				for x := 0; x < size; x++ {
+					tx, ty := s.Apply(size, x, y)
+					if !reflect.DeepEqual(p.At(x, y), q.At(tx, ty)) {
+						t.Fatalf("size=%d %s: (%d,%d) differs", size, s, x, y)
+					}
+				}
+			}
+			back := q.Transform(s.Inverse())
+			if back.Hash() != p.Hash() ||
+				!reflect.DeepEqual(squares(back), squares(p)) {
+				t.Fatalf("size=%d %s: inverse does not round-trip", size, s)
+			}
+			if h, sym := q.Canonical(); h != canon {
+				t.Fatalf("size=%d %s: canonical=%x want %x", size, s, h, canon)
+			} else if q.Transform(sym).Hash() != h {
+				t.Fatalf("size=%d %s: canonical symmetry %s", size, s, sym)
+			}
+
+			for _, m := range p.LegalMoves(nil) {
+				tm := m.Transform(size, s)
+				want, e := p.Move(&m)
+				if e != nil {
+					t.Fatalf("move: %v", e)
+				}
+				got, e := q.Move(&tm)
+				if e != nil {
+					t.Fatalf("size=%d %s: %#v -> %#v: %v", size, s, m, tm, e)
+				}
+				if got.Hash() != want.Transform(s).Hash() {
+					t.Fatalf("size=%d %s: %#v -> %#v differs", size, s, m, tm)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package tak
+
+import (
+	"math/bits"
+
+	"../bitboard"
+)
+
+// RoadThreats appends to `moves` every move that would complete a
+// road for `c` at once, were it `c`'s turn in `p`: placements of a
+// flat or capstone, and slides. Threats are found from the
+// bitboards, without making the moves.
+func (p *Position) RoadThreats(c Color, moves []Move) []Move {
+	p.roadThreats(c, func(m Move) bool {
+		moves = append(moves, m)
+		return true
+	})
+	return moves
+}
+
+// HasRoadThreat reports whether `c` could complete a road with a
+// single move, were it `c`'s turn in `p`.
+func (p *Position) HasRoadThreat(c Color) bool {
+	found := false
+	p.roadThreats(c, func(Move) bool {
+		found = true
+		return false
+	})
+	return found
+}
+
+// Tinue reports whether the player who just moved has a road threat
+// that the player to move cannot answer: every legal reply either
+// loses outright or leaves a road threat on the board.
+func (p *Position) Tinue() bool {
+	if over, _ := p.GameOver(); over {
+		return false
+	}
+	attacker := p.ToMove().Flip()
+	if !p.HasRoadThreat(attacker) {
+		return false
+	}
+	work := p.Clone()
+	var u Undo
+	for _, m := range p.LegalMoves(nil) {
+		if work.DoMove(&m, &u) != nil {
+			continue
+		}
+		escaped := false
+		if over, winner := work.GameOver(); over {
+			escaped = winner != attacker
+		} else {
+			escaped = !work.HasRoadThreat(attacker)
+		}
+		work.UndoMove(&u)
+		if escaped {
+			return false
+		}
+	}
+	return true
+}
+
+// spans reports whether `road` contains a chain joining two
+// opposite edges.
+func (p *Position) spans(road uint64) bool {
+	c := &p.cfg.c
+	if road&c.R != 0 && road&c.L != 0 &&
+		bitboard.Flood(c, road, road&c.R)&c.L != 0 {
+		return true
+	}
+	return road&c.B != 0 && road&c.T != 0 &&
+		bitboard.Flood(c, road, road&c.B)&c.T != 0
+}
+
+// roadThreats calls `f` with each road-completing move for `c`
+// until it returns false.
+func (p *Position) roadThreats(c Color, f func(Move) bool) {
+	if p.move < 2 {
+		return
+	}
+	mine := p.White
+	if c == Black {
+		mine = p.Black
+	}
+	road := mine &^ p.Standing
+	empty := p.cfg.c.Mask &^ (p.White | p.Black)
+
+	stones, caps := p.reserves(c)
+	if stones > 0 || caps > 0 {
+		for bits := empty; bits != 0; bits &= bits - 1 {
+			bit := lowBit(bits)
+			if !p.spans(road | bit) {
+				continue
+			}
+			i := bitIndex(bit)
+			x, y := i%p.cfg.Size, i/p.cfg.Size
+			if stones > 0 && !f(Move{x, y, PlaceFlat, nil}) {
+				return
+			}
+			if caps > 0 && !f(Move{x, y, PlaceCapstone, nil}) {
+				return
+			}
+		}
+	}
+
+	for bits := mine; bits != 0; bits &= bits - 1 {
+		i := uint(bitIndex(lowBit(bits)))
+		x, y := int(i)%p.cfg.Size, int(i)/p.cfg.Size
+		h := p.Height[i]
+		if h > uint8(p.cfg.Size) {
+			h = uint8(p.cfg.Size)
+		}
+		for _, d := range [...]MoveType{SlideLeft, SlideRight, SlideDown, SlideUp} {
+			reach, smash := p.slideReach(x, y, d)
+			far := reach
+			if smash {
+				far++
+			}
+			// the slide can only help by uncovering a road
+			// piece at `i` or by covering squares along the line
+			line := p.line(i, d, far)
+			if line == 0 || !p.spans(road|line|1<<i) {
+				continue
+			}
+			for _, s := range slides[h] {
+				if len(s) > reach &&
+					!(smash && len(s) == reach+1 && s[reach] == 1) {
+					continue
+				}
+				if p.spans(p.slideRoad(c, road, i, d, s)) &&
+					!f(Move{x, y, d, s}) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// line returns the `n` squares beyond `i` in direction `d`.
+func (p *Position) line(i uint, d MoveType, n int) uint64 {
+	var out uint64
+	step := p.step(d)
+	for k := 1; k <= n; k++ {
+		out |= 1 << uint(int(i)+k*step)
+	}
+	return out
+}
+
+func (p *Position) step(d MoveType) int {
+	switch d {
+	case SlideLeft:
+		return -1
+	case SlideRight:
+		return 1
+	case SlideDown:
+		return -p.cfg.Size
+	}
+	return p.cfg.Size
+}
+
+// slideRoad returns `c`'s road squares after the slide `s` from
+// square `i` in direction `d`, given `road`, the road squares
+// before it.
+func (p *Position) slideRoad(c Color, road uint64, i uint, d MoveType, s []byte) uint64 {
+	var mine uint64
+	if c == Black {
+		mine = 1
+	}
+	n := 0
+	for _, k := range s {
+		n += int(k)
+	}
+	bit := uint64(1) << i
+	road &^= bit
+	if n < int(p.Height[i]) && p.buried(i, uint(n)) == mine {
+		road |= bit
+	}
+	step := p.step(d)
+	sq := int(i)
+	for _, k := range s {
+		sq += step
+		n -= int(k)
+		bit := uint64(1) << uint(sq)
+		road &^= bit
+		switch {
+		case n > 0:
+			if p.buried(i, uint(n)) == mine {
+				road |= bit
+			}
+		case p.Standing&(1<<i) == 0:
+			road |= bit
+		}
+	}
+	return road
+}
+
+// bitIndex returns the index of `bit`, which has a single bit set.
+func bitIndex(bit uint64) int {
+	return bits.TrailingZeros64(bit)
+}
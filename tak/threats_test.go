@@ -0,0 +1,141 @@
+package tak
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// slowRoadThreats finds road threats by making every legal move.
+func slowRoadThreats(p *Position, c Color) []string {
+	if p.ToMove() != c {
+		p = p.Clone()
+		p.IncrementMove()
+	}
+	var out []string
+	for _, m := range p.LegalMoves(nil) {
+		next, e := p.Move(&m)
+		if e != nil {
+			panic(e)
+		}
+		if w, ok := next.hasRoad(); ok && w == c {
+			out = append(out, fmt.Sprint(m))
+		}
+	}
+	return out
+}
+
+func moveStrings(ms []Move) []string {
+	var out []string
+	for _, m := range ms {
+		out = append(out, fmt.Sprint(m))
+	}
+	return out
+}
+
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sort.Slice(a, func(i, j int) bool { return a[i] < a[j] })
+	sort.Slice(b, func(i, j int) bool { return b[i] < b[j] })
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRoadThreats(t *testing.T) {
+	r := rand.New(rand.NewSource(11))
+	found := 0
+	for trial := 0; trial < 300; trial++ {
+		size := 3 + trial%6
+		p := New(Config{Size: size})
+		for ply := 0; ply < 60; ply++ {
+			for _, c := range []Color{White, Black} {
+				want := slowRoadThreats(p, c)
+				got := p.RoadThreats(c, nil)
+				if !sameSet(moveStrings(got), want) {
+					t.Fatalf("size=%d ply=%d %s: got %v want %v",
+						size, ply, c, moveStrings(got), want)
+				}
+				if p.HasRoadThreat(c) != (len(want) > 0) {
+					t.Fatalf("size=%d ply=%d %s: HasRoadThreat", size, ply, c)
+				}
+				found += len(want)
+			}
+			moves := p.LegalMoves(nil)
+			next, _ := p.Move(&moves[r.Intn(len(moves))])
+			if over, _ := next.GameOver(); over {
+				break
+			}
+			p = next
+		}
+	}
+	if found == 0 {
+		t.Fatal("no threats seen")
+	}
+}
+
+func TestRoadThreatSlide(t *testing.T) {
+	p := New(Config{Size: 5})
+	for x := 0; x < 4; x++ {
+		set(p, x, 2, Square{MakePiece(White, Flat)})
+	}
+	// a white-topped stack above the gap, and a black wall in it
+	set(p, 4, 3, Square{MakePiece(White, Flat), MakePiece(Black, Flat)})
+	set(p, 4, 2, Square{MakePiece(Black, Standing)})
+	set(p, 3, 3, Square{MakePiece(Black, Standing)})
+	p.move = 10
+	p.analyze()
+
+	got := p.RoadThreats(White, nil)
+	if len(got) != 0 {
+		t.Fatalf("threats through a wall: %#v", got)
+	}
+	set(p, 4, 2, nil)
+	got = p.RoadThreats(White, nil)
+	want := []Move{
+		{X: 4, Y: 2, Type: PlaceFlat},
+		{X: 4, Y: 2, Type: PlaceCapstone},
+		{X: 4, Y: 3, Type: SlideDown, Slides: []byte{1}},
+		{X: 4, Y: 3, Type: SlideDown, Slides: []byte{2}},
+	}
+	if !sameSet(moveStrings(got), moveStrings(want)) {
+		t.Fatalf("threats=%#v", got)
+	}
+}
+
+func TestTinue(t *testing.T) {
+	p := New(Config{Size: 5})
+	for x := 1; x < 5; x++ {
+		set(p, x, 0, Square{MakePiece(White, Flat)})
+	}
+	set(p, 1, 4, Square{MakePiece(Black, Flat)})
+	set(p, 3, 4, Square{MakePiece(Black, Flat)})
+	p.move = 11
+	p.analyze()
+	if p.Tinue() {
+		t.Fatal("single threat is tinue")
+	}
+
+	for x := 0; x < 4; x++ {
+		set(p, x, 2, Square{MakePiece(White, Flat)})
+	}
+	p.analyze()
+	if !p.Tinue() {
+		t.Fatal("double threat is not tinue")
+	}
+
+	// black to move can answer by winning first
+	for x := 0; x < 4; x++ {
+		set(p, x, 4, Square{MakePiece(Black, Flat)})
+	}
+	p.analyze()
+	if p.Tinue() {
+		t.Fatal("tinue despite a black road threat")
+	}
+}
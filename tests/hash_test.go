@@ -2,6 +2,7 @@ package tests
 
 import (
 	"flag"
+	"math/rand"
 	"testing"
 
 	"golang.org/x/net/context"
@@ -33,6 +34,13 @@ func equal(a, b *tak.Position) bool {
 	if a.Caps != b.Caps {
 		return false
 	}
+	if a.ToMove() != b.ToMove() {
+		return false
+	}
+	if a.WhiteStones() != b.WhiteStones() || a.WhiteCaps() != b.WhiteCaps() ||
+		a.BlackStones() != b.BlackStones() || a.BlackCaps() != b.BlackCaps() {
+		return false
+	}
 	for i := range a.Height {
 		if a.Height[i] != b.Height[i] {
 			return false
@@ -44,7 +52,7 @@ func equal(a, b *tak.Position) bool {
 	return true
 }
 
-func reportCollisions(t *testing.T, tbl map[uint64][]*tak.Position) {
+func reportCollisions(t *testing.T, tbl map[uint64][]*tak.Position) int {
 	var n, collisions int
 	for h, l := range tbl {
 		n += len(l)
@@ -62,6 +70,7 @@ func reportCollisions(t *testing.T, tbl map[uint64][]*tak.Position) {
 
 	t.Logf("evaluated %d positions and %d hashes, with %d collisions",
 		n, len(tbl), collisions)
+	return collisions
 }
 
 func TestHash(t *testing.T) {
@@ -93,3 +102,34 @@ func testCollisions(t *testing.T, p *tak.Position) {
 	}
 	reportCollisions(t, tbl)
 }
+
+func TestHashCollisionRate(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	for _, size := range []int{4, 5, 6} {
+		tbl := make(map[uint64][]*tak.Position)
+		for g := 0; g < 200; g++ {
+			p := tak.New(tak.Config{Size: size})
+			for ply := 0; ply < 100; ply++ {
+				tbl[p.Hash()] = append(tbl[p.Hash()], p)
+				if ok, _ := p.GameOver(); ok {
+					break
+				}
+				moves := p.AllMoves(nil)
+				var next *tak.Position
+				for _, i := range r.Perm(len(moves)) {
+					var e error
+					if next, e = p.Move(&moves[i]); e == nil {
+						break
+					}
+				}
+				if next == nil {
+					break
+				}
+				p = next
+			}
+		}
+		if n := reportCollisions(t, tbl); n != 0 {
+			t.Errorf("size=%d: %d hash collisions", size, n)
+		}
+	}
+}
@@ -28,8 +28,8 @@ func TestPlayPTNs(t *testing.T) {
 }
 
 func playPTN(t *testing.T, p *ptn.PTN) {
-	id := p.FindTag("Id")
-	if id == "" {
+	id, _ := p.Id()
+	if id == 0 {
 		return
 	}
 	t.Log("playing", id)